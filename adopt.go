@@ -2,8 +2,12 @@ package main
 
 func adoptEntry(e *Entry) {
 	if len(e.Level) == 0 {
-		if len(e.Priority) == 3 {
+		switch {
+		case len(e.Priority) == 3 && e.Priority[0] == '"':
 			e.Level = priorityToLevel(e.Priority[1])
+		case len(e.Priority) == 1:
+			// Unquoted number.
+			e.Level = priorityToLevel(e.Priority[0])
 		}
 	}
 
@@ -14,18 +18,28 @@ func adoptEntry(e *Entry) {
 			e.Time = e.RealtimeTimestamp
 		}
 	}
+
+	e.Severity = parseSeverity(e.Level)
 }
 
 func priorityToLevel(pr byte) []byte {
 	switch pr {
 	case '7':
 		return []byte(`"debug"`)
-	case '6', '5':
+	case '6':
 		return []byte(`"info"`)
+	case '5':
+		return []byte(`"notice"`)
 	case '4':
 		return []byte(`"warn"`)
-	case '3', '2', '1':
+	case '3':
 		return []byte(`"error"`)
+	case '2':
+		return []byte(`"crit"`)
+	case '1':
+		return []byte(`"alert"`)
+	case '0':
+		return []byte(`"emerg"`)
 	default:
 		return []byte(`"unknown"`)
 	}
@@ -7,7 +7,6 @@ import (
 	"time"
 
 	"github.com/ssgreg/logf"
-	"github.com/ssgreg/logftext"
 )
 
 var goldenN = []byte(`{"level":"debug","ts":"2018-12-13T22:21:26.84954039+03:00","logger":"token","msg":"request done","caller":"token/resource.go:66","scope-type":"root","scope-value":"","attempt":1,"request-id":"SL2DYF5L6XGT4BGQ","status":200}` + "\n")
@@ -37,19 +36,37 @@ func BenchmarkDefault(b *testing.B) {
 }
 
 func BenchmarkParse(b *testing.B) {
+	var e Entry
 	for i := 0; i < b.N; i++ {
-		_, _ = parse(golden)
+		e.reset()
+		_ = parse(golden, defaultFieldMapping, &e)
 	}
 }
 
 func BenchmarkFormat(b *testing.B) {
-	eseq := logftext.EscapeSequence{NoColor: true}
+	f := newFormatter(Options{NoColor: true, TimeFormat: time.StampMilli})
 	buf := logf.NewBufferWithCapacity(4096)
 
+	var e Entry
 	for i := 0; i < b.N; i++ {
 		buf.Reset()
-		e, _ := parse(golden)
+		e.reset()
+		_ = parse(golden, defaultFieldMapping, &e)
 		adoptEntry(&e)
-		format(buf, eseq, &e, time.StampMilli)
+		f.format(buf, &e)
+	}
+}
+
+func BenchmarkFormatJSON(b *testing.B) {
+	f := newFormatter(Options{NoColor: true, Output: outputJSON})
+	buf := logf.NewBufferWithCapacity(4096)
+
+	var e Entry
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		e.reset()
+		_ = parse(golden, defaultFieldMapping, &e)
+		adoptEntry(&e)
+		f.format(buf, &e)
 	}
 }
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// The configuration file is a TOML or YAML file with default values of
+// options. Files with ".yaml" or ".yml" extension are YAML, other files
+// are TOML. Keys are long names of options. Named profiles override the defaults
+// and are selected with --profile option or default-profile key:
+//
+// 	time-format = "2006-01-02 15:04:05.000"
+// 	map = ["msg=message"]
+// 	default-profile = "api"
+//
+// 	[profile.api]
+// 	level = "info"
+// 	where = ["service=api"]
+//
+// 	[theme.mine]
+// 	inherit = "light"
+// 	key = "#0072b2"
+// 	level-warn = "bold 208"
+//
+// The same in YAML:
+//
+// 	time-format: "2006-01-02 15:04:05.000"
+// 	map: [msg=message]
+// 	default-profile: api
+// 	profile:
+// 	  api:
+// 	    level: info
+//
+// Options specified in the command line take precedence over the profile.
+// Custom themes are selected with --theme option.
+
+const (
+	// Section of the configuration file with named profiles.
+	configProfileSection = "profile"
+
+	// Key of the configuration file with a default profile. It can't be
+	// "profile" as the profile section has this name.
+	configProfileKey = "default-profile"
+
+	// Section of the configuration file with custom themes.
+	configThemeSection = "theme"
+)
+
+// Names of the configuration file in the order they are looked for.
+var configNames = []string{"config", "config.yaml", "config.yml"}
+
+// defaultConfigPath returns a path to the existing configuration file in
+// $XDG_CONFIG_HOME/hlogf or ~/.config/hlogf, or an empty string.
+func defaultConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+
+	for _, name := range configNames {
+		path := filepath.Join(dir, "hlogf", name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+
+	return ""
+}
+
+// isYAMLConfig checks whether the configuration file is a YAML file.
+func isYAMLConfig(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// decodeConfigFile decodes the configuration file to values.
+func decodeConfigFile(path string, values map[string]interface{}) error {
+	if !isYAMLConfig(path) {
+		_, err := toml.DecodeFile(path, &values)
+
+		return err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return yaml.Unmarshal(data, &values)
+}
+
+// config holds the content of the configuration file.
+type config struct {
+	path     string
+	values   map[string]interface{}
+	profiles map[string]map[string]interface{}
+	themes   map[string]themeSpec
+}
+
+// loadConfig loads the configuration file. If the path is empty, the
+// default one is used and it's not an error if the file doesn't exist.
+func loadConfig(path string) (*config, error) {
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigPath()
+		if path == "" {
+			return &config{}, nil
+		}
+	}
+
+	values := make(map[string]interface{})
+	err := decodeConfigFile(path, values)
+	if err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return &config{}, nil
+		}
+
+		return nil, fmt.Errorf("failed to load config: %s", err)
+	}
+
+	c := &config{
+		path:     path,
+		values:   values,
+		profiles: make(map[string]map[string]interface{}),
+		themes:   make(map[string]themeSpec),
+	}
+	if section, ok := values[configProfileSection]; ok {
+		delete(values, configProfileSection)
+
+		profiles, ok := section.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("config %s: %q must be a table of profiles", path, configProfileSection)
+		}
+		for name, profile := range profiles {
+			values, ok := profile.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("config %s: profile %q must be a table", path, name)
+			}
+			c.profiles[name] = values
+		}
+	}
+
+	if section, ok := values[configThemeSection]; ok {
+		delete(values, configThemeSection)
+
+		themes, ok := section.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("config %s: %q must be a table of themes", path, configThemeSection)
+		}
+		for name, theme := range themes {
+			values, ok := theme.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("config %s: theme %q must be a table", path, name)
+			}
+			spec := make(themeSpec, len(values))
+			for k, v := range values {
+				s, ok := v.(string)
+				if !ok {
+					return nil, fmt.Errorf("config %s: theme %q: %q must be a string", path, name, k)
+				}
+				spec[k] = s
+			}
+			c.themes[name] = spec
+		}
+	}
+
+	return c, nil
+}
+
+// apply sets the flags that were not specified in the command line to
+// values from the configuration file and the given profile.
+func (c *config) apply(flags *pflag.FlagSet, profile string) error {
+	if profile == "" {
+		if name, ok := c.values[configProfileKey].(string); ok {
+			profile = name
+		}
+	}
+	delete(c.values, configProfileKey)
+
+	values := make(map[string]interface{}, len(c.values))
+	for k, v := range c.values {
+		values[k] = v
+	}
+	if profile != "" {
+		if c.path == "" {
+			return fmt.Errorf("profile %q is specified, but there's no config file", profile)
+		}
+		p, ok := c.profiles[profile]
+		if !ok {
+			return fmt.Errorf("config %s: profile %q is not found", c.path, profile)
+		}
+		for k, v := range p {
+			values[k] = v
+		}
+	}
+
+	for name, value := range values {
+		f := flags.Lookup(name)
+		if f == nil {
+			return fmt.Errorf("config %s: unknown option %q", c.path, name)
+		}
+		if f.Changed {
+			continue
+		}
+
+		items, err := configValueStrings(value)
+		if err != nil {
+			return fmt.Errorf("config %s: option %q: %s", c.path, name, err)
+		}
+		for _, item := range items {
+			err = flags.Set(name, item)
+			if err != nil {
+				return fmt.Errorf("config %s: option %q: %s", c.path, name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// configValueStrings converts a value of the configuration file to a list
+// of strings suitable for flag values.
+func configValueStrings(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case bool:
+		return []string{strconv.FormatBool(v)}, nil
+	case int64:
+		return []string{strconv.FormatInt(v, 10)}, nil
+	case int:
+		return []string{strconv.Itoa(v)}, nil
+	case float64:
+		return []string{strconv.FormatFloat(v, 'g', -1, 64)}, nil
+	case []interface{}:
+		var r []string
+		for _, item := range v {
+			if _, ok := item.([]interface{}); ok {
+				return nil, fmt.Errorf("nested arrays are not supported")
+			}
+			s, err := configValueStrings(item)
+			if err != nil {
+				return nil, err
+			}
+			r = append(r, s...)
+		}
+
+		return r, nil
+	}
+
+	return nil, fmt.Errorf("unsupported value type %T", value)
+}
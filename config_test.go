@@ -0,0 +1,208 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfig = `
+time-format = "15:04"
+default-profile = "api"
+where = ["a=1", "b=2"]
+flatten = true
+flatten-depth = 2
+
+[profile.api]
+grep = "api"
+fields = ["status", "duration"]
+
+[profile.db]
+grep = "db"
+time-format = "15:04:05"
+
+[theme.mine]
+inherit = "light"
+key = "#0072b2"
+`
+
+func writeConfig(t *testing.T, content string) string {
+	return writeConfigNamed(t, "config", content)
+}
+
+func writeConfigNamed(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	err := ioutil.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestConfigProfiles(t *testing.T) {
+	path := writeConfig(t, testConfig)
+
+	cases := []struct {
+		args       []string
+		profile    string
+		grep       string
+		timeFormat string
+	}{
+		// The default-profile key selects the default profile.
+		{nil, "", "api", "15:04"},
+		{nil, "db", "db", "15:04:05"},
+		// The command line takes precedence over the profile.
+		{[]string{"--grep", "cli", "-t", "15"}, "db", "cli", "15"},
+	}
+
+	for i, c := range cases {
+		flags := parseFlags(t, c.args...)
+		themes, err := handleConfigOptions(flags, path, c.profile)
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+
+		if r := flags.Lookup("grep").Value.String(); r != c.grep {
+			t.Errorf("%d: unexpected grep %q, expected %q", i, r, c.grep)
+		}
+		if r := flags.Lookup("time-format").Value.String(); r != c.timeFormat {
+			t.Errorf("%d: unexpected time format %q, expected %q", i, r, c.timeFormat)
+		}
+		if themes["mine"]["key"] != "#0072b2" || themes["mine"]["inherit"] != "light" {
+			t.Errorf("%d: unexpected themes %v", i, themes)
+		}
+	}
+}
+
+func TestConfigValues(t *testing.T) {
+	flags := parseFlags(t)
+	_, err := handleConfigOptions(flags, writeConfig(t, testConfig), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	where, _ := flags.GetStringArray("where")
+	fields, _ := flags.GetStringSlice("fields")
+	flatten, _ := flags.GetBool("flatten")
+	depth, _ := flags.GetInt("flatten-depth")
+	if strings.Join(where, ";") != "a=1;b=2" || strings.Join(fields, ";") != "status;duration" || !flatten || depth != 2 {
+		t.Errorf("unexpected values: %q %q %v %d", where, fields, flatten, depth)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	cases := []struct {
+		content string
+		profile string
+		err     string
+	}{
+		{`unknown = 1`, "", `unknown option "unknown"`},
+		{`[profile.api]` + "\n" + `nope = 1`, "api", `unknown option "nope"`},
+		{`grep = "a"`, "api", `profile "api" is not found`},
+		{`default-profile = "db"`, "", `profile "db" is not found`},
+		{`number = "maybe"`, "", `option "number"`},
+		{`where = [["a"]]`, "", `nested arrays are not supported`},
+		{`profile = "api"`, "", `"profile" must be a table of profiles`},
+		{`profile = {api = 1}`, "api", `profile "api" must be a table`},
+		{`[theme.mine]` + "\n" + `key = 1`, "", `theme "mine": "key" must be a string`},
+		{`theme = "light"`, "", `"theme" must be a table of themes`},
+		{`grep = `, "", `failed to load config`},
+	}
+
+	for i, c := range cases {
+		flags := parseFlags(t)
+		_, err := handleConfigOptions(flags, writeConfig(t, c.content), c.profile)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%d: unexpected error %v, expected %q", i, err, c.err)
+		}
+	}
+
+	// An explicitly passed config file must exist.
+	_, err := handleConfigOptions(parseFlags(t), filepath.Join(dir, "missing"), "")
+	if err == nil || !strings.Contains(err.Error(), "failed to load config") {
+		t.Errorf("unexpected error for a missing config: %v", err)
+	}
+
+	// The default config file is optional, but a profile requires it.
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	_, err = handleConfigOptions(parseFlags(t), "", "")
+	if err != nil {
+		t.Errorf("unexpected error for a missing default config: %s", err)
+	}
+	_, err = handleConfigOptions(parseFlags(t), "", "api")
+	if err == nil || !strings.Contains(err.Error(), "there's no config file") {
+		t.Errorf("unexpected error for a profile without config: %v", err)
+	}
+}
+
+const testYAMLConfig = `
+time-format: "15:04"
+default-profile: api
+where: [a=1, b=2]
+flatten: true
+flatten-depth: 2
+profile:
+  api:
+    grep: api
+    fields: [status, duration]
+theme:
+  mine:
+    inherit: light
+    key: "#0072b2"
+`
+
+func TestConfigYAML(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"config.yaml", "config.yml"} {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, []byte(testYAMLConfig), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		flags := parseFlags(t)
+		themes, err := handleConfigOptions(flags, path, "")
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		where, _ := flags.GetStringArray("where")
+		fields, _ := flags.GetStringSlice("fields")
+		depth, _ := flags.GetInt("flatten-depth")
+		grep := flags.Lookup("grep").Value.String()
+		if strings.Join(where, ";") != "a=1;b=2" || strings.Join(fields, ";") != "status;duration" || depth != 2 || grep != "api" {
+			t.Errorf("%s: unexpected values: %q %q %d %q", name, where, fields, depth, grep)
+		}
+		if themes["mine"]["key"] != "#0072b2" {
+			t.Errorf("%s: unexpected themes %v", name, themes)
+		}
+	}
+
+	// The default config file may be a YAML file.
+	err := os.MkdirAll(filepath.Join(dir, "hlogf"), 0700)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "hlogf", "config.yaml"), []byte("time-format: default\n"), 0600)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	flags := parseFlags(t)
+	_, err = handleConfigOptions(flags, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := flags.Lookup("time-format").Value.String(); r != "default" {
+		t.Errorf("unexpected time format %q", r)
+	}
+
+	_, err = handleConfigOptions(parseFlags(t), writeConfigNamed(t, "bad.yaml", "grep: [a"), "")
+	if err == nil || !strings.Contains(err.Error(), "failed to load config") {
+		t.Errorf("unexpected error for a bad YAML config: %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/ssgreg/logf"
+)
+
+// Container runtimes wrap lines of applications into envelopes:
+//
+//   - Docker json-file driver writes JSON objects with the line, the
+//     stream and the time:
+//
+//     {"log":"{\"level\":\"info\",\"msg\":\"started\"}\n","stream":"stderr","time":"2023-01-01T00:00:00.000000001Z"}
+//
+//   - CRI runtimes (Kubernetes nodes) prefix lines with the time, the
+//     stream and a tag, 'F' for full lines and 'P' for partial ones that
+//     are continued in the next line of the same stream:
+//
+//     2023-01-01T00:00:00.000000001Z stdout F {"level":"info","msg":"started"}
+//
+// Application lines are parsed as JSON or logfmt, or used as messages
+// otherwise. The envelope time is used if the line has no time. The
+// stream is added as "stream" field.
+
+var streamKey = []byte("stream")
+
+// criLine is a line of CRI container logs.
+type criLine struct {
+	time    []byte
+	stream  []byte
+	partial bool
+	content []byte
+}
+
+// parseCRILine parses the prefix of a CRI container log line.
+func parseCRILine(data []byte) (criLine, bool) {
+	var l criLine
+
+	i := bytes.IndexByte(data, ' ')
+	if i < len("2006-01-02T15:04:05Z") || data[4] != '-' || data[10] != 'T' {
+		return l, false
+	}
+	l.time = data[:i]
+	data = data[i+1:]
+
+	if !bytes.HasPrefix(data, []byte("stdout ")) && !bytes.HasPrefix(data, []byte("stderr ")) {
+		return l, false
+	}
+	l.stream = data[:len("stdout")]
+	data = data[len("stdout "):]
+
+	if len(data) == 0 || (data[0] != 'F' && data[0] != 'P') || (len(data) > 1 && data[1] != ' ') {
+		return l, false
+	}
+	l.partial = data[0] == 'P'
+	if len(data) > 1 {
+		l.content = data[2:]
+	}
+
+	return l, true
+}
+
+// criJoiner joins partial lines of CRI container logs. Lines of stdout and
+// stderr streams are joined separately.
+type criJoiner struct {
+	pending [2][]byte
+}
+
+// add handles the next line, emitting lines that are ready: full lines
+// joined with preceding partial ones and lines that are not CRI ones.
+// Joined lines are newly allocated.
+func (j *criJoiner) add(data []byte, emit func([]byte)) {
+	l, ok := parseCRILine(data)
+	if !ok {
+		// Partial lines are not continued any more.
+		j.flush(emit)
+		emit(data)
+
+		return
+	}
+
+	s := 0
+	if l.stream[3] == 'e' {
+		s = 1
+	}
+
+	switch {
+	case j.pending[s] == nil && !l.partial:
+		emit(data)
+	case j.pending[s] == nil:
+		// The first partial line keeps the prefix with the tag changed.
+		j.pending[s] = append([]byte(nil), data...)
+		j.pending[s][len(l.time)+len(" stdout ")] = 'F'
+	default:
+		j.pending[s] = append(j.pending[s], l.content...)
+		if !l.partial {
+			emit(j.pending[s])
+			j.pending[s] = nil
+		}
+	}
+}
+
+// flush emits all pending partial lines as they are.
+func (j *criJoiner) flush(emit func([]byte)) {
+	for s := range j.pending {
+		if j.pending[s] != nil {
+			emit(j.pending[s])
+			j.pending[s] = nil
+		}
+	}
+}
+
+// parseCRI parses a CRI container log line to the given entry.
+func parseCRI(l criLine, m *fieldMapping, t *Entry) bool {
+	return parseEnvelope(l.content, t.quoteString(l.stream), t.quoteString(l.time), m, t)
+}
+
+// parseDocker parses a line of Docker json-file driver to the given entry.
+// It returns false if the line is not an envelope.
+func parseDocker(data []byte, m *fieldMapping, t *Entry) bool {
+	var log, stream, ts []byte
+	ok := walkObject(data, func(key, val []byte) bool {
+		switch string(key) {
+		case "log":
+			log = val
+		case "stream":
+			stream = val
+		case "time":
+			ts = val
+		}
+
+		return true
+	})
+	if !ok || len(log) < 2 || log[0] != '"' || len(stream) == 0 || len(ts) == 0 {
+		return false
+	}
+
+	// The line is unescaped to the arena.
+	start := len(t.arena)
+	b := logf.Buffer{Data: t.arena}
+	unescapeString(&b, log[1:len(log)-1])
+	t.arena = b.Data
+	line := bytes.TrimRight(t.arena[start:len(t.arena):len(t.arena)], "\r\n")
+
+	return parseEnvelope(line, stream, ts, m, t)
+}
+
+// parseEnvelope parses the application line of a container log envelope.
+// The stream and the time are in JSON form.
+func parseEnvelope(line, stream, ts []byte, m *fieldMapping, t *Entry) bool {
+	if len(line) == 0 || !parseLine(line, m, t) {
+		// Plain text, the arena is kept as the line may be there.
+		*t = Entry{Fields: t.Fields[:0], arena: t.arena}
+		t.Msg = t.quoteString(line)
+	}
+
+	if len(t.Time) == 0 {
+		t.Time = ts
+	}
+	t.Fields = append(t.Fields, Field{streamKey, stream})
+
+	return true
+}
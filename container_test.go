@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCRIJoiner(t *testing.T) {
+	lines := []string{
+		`2023-01-01T00:00:00Z stdout P {"msg":`,
+		`2023-01-01T00:00:00Z stderr F err`,
+		`2023-01-01T00:00:00Z stdout P "jo`,
+		`2023-01-01T00:00:00Z stdout F ined"}`,
+		`2023-01-01T00:00:00Z stdout P dangling`,
+		`not a cri line`,
+	}
+	expected := []string{
+		`2023-01-01T00:00:00Z stderr F err`,
+		`2023-01-01T00:00:00Z stdout F {"msg":"joined"}`,
+		`2023-01-01T00:00:00Z stdout F dangling`,
+		`not a cri line`,
+	}
+
+	var j criJoiner
+	var r []string
+	for _, line := range lines {
+		j.add([]byte(line), func(data []byte) {
+			r = append(r, string(data))
+		})
+	}
+	if strings.Join(r, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(r, "\n"))
+	}
+}
+
+func TestParseContainerLines(t *testing.T) {
+	cases := []struct {
+		line     string
+		expected string
+	}{
+		{
+			`{"log":"{\"level\":\"info\",\"msg\":\"started\"}\n","stream":"stderr","time":"2023-01-01T00:00:00Z"}`,
+			`"2023-01-01T00:00:00Z" "info" "started" stream="stderr"`,
+		},
+		{
+			`{"log":"plain \"text\"\n","stream":"stdout","time":"2023-01-01T00:00:00Z"}`,
+			`"2023-01-01T00:00:00Z"  "plain \"text\"" stream="stdout"`,
+		},
+		{
+			`2023-01-01T00:00:00Z stdout F ts=2023-01-02T00:00:00Z level=warn msg=x`,
+			`"2023-01-02T00:00:00Z" "warn" "x" stream="stdout"`,
+		},
+	}
+
+	for _, c := range cases {
+		var e Entry
+		if !parse([]byte(c.line), defaultFieldMapping, &e) {
+			t.Errorf("%s: failed to parse", c.line)
+
+			continue
+		}
+
+		r := string(e.Time) + " " + string(e.Level) + " " + string(e.Msg)
+		for _, f := range e.Fields {
+			r += " " + string(f.Key) + "=" + string(f.Value)
+		}
+		if r != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.line, c.expected, r)
+		}
+	}
+}
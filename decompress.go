@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Compressed inputs, e.g. rotated "app.log.3.gz", are detected by magic
+// bytes and decompressed on the fly. Other inputs are read as is.
+
+// compression describes a compressed format. The extension is the usual
+// one of compressed files.
+type compression struct {
+	name  string
+	ext   string
+	magic []byte
+	open  func(io.Reader) (io.ReadCloser, error)
+}
+
+var compressions = []compression{
+	{"gzip", ".gz", []byte{0x1f, 0x8b}, func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	}},
+	{"bzip2", ".bz2", []byte("BZh"), func(r io.Reader) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bzip2.NewReader(r)), nil
+	}},
+	{"zstd", ".zst", []byte{0x28, 0xb5, 0x2f, 0xfd}, func(r io.Reader) (io.ReadCloser, error) {
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.IOReadCloser(), nil
+	}},
+	{"xz", ".xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, func(r io.Reader) (io.ReadCloser, error) {
+		d, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+
+		return ioutil.NopCloser(d), nil
+	}},
+}
+
+// Size of the beginning of the data that is enough to detect any
+// compression.
+const compressionHeadSize = 8
+
+// compressionOf returns the compression of the data with the given
+// beginning.
+func compressionOf(head []byte) (compression, bool) {
+	for _, c := range compressions {
+		if !bytes.HasPrefix(head, c.magic) {
+			continue
+		}
+		if c.name == "bzip2" {
+			// The magic is followed by the block size from '1' to '9'.
+			if len(head) <= len(c.magic) || head[len(c.magic)] < '1' || head[len(c.magic)] > '9' {
+				continue
+			}
+		}
+
+		return c, true
+	}
+
+	return compression{}, false
+}
+
+// decompress returns a reader of the decompressed data if the data read
+// from r is compressed, or a reader of the data as is otherwise.
+func decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+
+	// The first byte is checked alone not to wait for more data of an
+	// interactive input that is not compressed.
+	head, _ := br.Peek(1)
+	if len(head) == 0 {
+		return ioutil.NopCloser(br), nil
+	}
+	for _, c := range compressions {
+		if head[0] == c.magic[0] {
+			head, _ = br.Peek(compressionHeadSize)
+
+			break
+		}
+	}
+
+	c, ok := compressionOf(head)
+	if !ok {
+		return ioutil.NopCloser(br), nil
+	}
+	d, err := c.open(br)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", c.name, err)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func TestDecompress(t *testing.T) {
+	const data = "{\"msg\":\"hello\"}\n"
+
+	compress := map[string]func(w io.Writer) io.WriteCloser{
+		"gzip": func(w io.Writer) io.WriteCloser {
+			return gzip.NewWriter(w)
+		},
+		"zstd": func(w io.Writer) io.WriteCloser {
+			z, _ := zstd.NewWriter(w)
+
+			return z
+		},
+		"xz": func(w io.Writer) io.WriteCloser {
+			z, _ := xz.NewWriter(w)
+
+			return z
+		},
+	}
+	for name, newWriter := range compress {
+		var b bytes.Buffer
+		w := newWriter(&b)
+		_, _ = w.Write([]byte(data))
+		_ = w.Close()
+
+		r, err := decompress(&b)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		result, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if string(result) != data {
+			t.Errorf("%s: unexpected result: %q", name, result)
+		}
+	}
+
+	// Data that is not compressed is read as is.
+	for _, plain := range []string{"", "B", "BZh line", "\x1f", data} {
+		r, err := decompress(bytes.NewReader([]byte(plain)))
+		if err != nil {
+			t.Fatalf("%q: %s", plain, err)
+		}
+		result, _ := ioutil.ReadAll(r)
+		if string(result) != plain {
+			t.Errorf("unexpected result: %q, expected: %q", result, plain)
+		}
+	}
+
+	// Broken compressed data.
+	_, err := decompress(bytes.NewReader([]byte{0x1f, 0x8b, 0}))
+	if err == nil {
+		t.Error("expected error for broken gzip header")
+	}
+}
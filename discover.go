@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// File operands may be directories and glob patterns, e.g. 'logs/**/*.json',
+// where "**" matches any number of directories. Files found in them are
+// filtered with include and exclude patterns of base names and sorted by
+// name or modification time. Binary files are skipped with a warning.
+// Files given explicitly are used as is.
+
+// Size of the beginning of a file that is checked for binary data.
+const binaryCheckSize = 8000
+
+// fileFinder expands file operands to files.
+type fileFinder struct {
+	recursive bool
+	include   []string
+	exclude   []string
+	byMtime   bool
+
+	// In follow mode patterns may match no files yet.
+	follow bool
+
+	// Files that are already found.
+	seen map[string]bool
+}
+
+// foundFile is a file found in a directory or by a pattern.
+type foundFile struct {
+	name  string
+	mtime time.Time
+}
+
+// expand expands the operands to files. Files that were found before are
+// skipped, so only new files are returned when it's called again.
+func (d *fileFinder) expand(operands []string) ([]string, error) {
+	if d.seen == nil {
+		d.seen = make(map[string]bool)
+	}
+
+	var files []string
+	for _, operand := range operands {
+		var found []foundFile
+		var err error
+		// Existing files are not patterns even if their names contain
+		// meta characters, e.g. "app[1].log".
+		info, serr := os.Stat(operand)
+		switch {
+		case operand == "-":
+		case serr == nil && info.IsDir():
+			found, err = walkDir(operand, d.recursive)
+		case serr != nil && hasGlobMeta(operand):
+			found, err = globFiles(operand)
+			if err == nil && len(found) == 0 && !d.follow {
+				err = fmt.Errorf("no files match %s", operand)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if found == nil {
+			// Explicit file or stdin.
+			if !d.seen[operand] {
+				d.seen[operand] = true
+				files = append(files, operand)
+			}
+
+			continue
+		}
+
+		d.sort(found)
+		for _, f := range found {
+			if d.seen[f.name] || !d.match(f.name) {
+				continue
+			}
+			d.seen[f.name] = true
+			if isBinaryFile(f.name) {
+				_, _ = fmt.Fprintf(os.Stderr, "hlogf: %s: binary file skipped\n", f.name)
+
+				continue
+			}
+			files = append(files, f.name)
+		}
+	}
+
+	return files, nil
+}
+
+// match checks the base name of the file against include and exclude
+// patterns.
+func (d *fileFinder) match(name string) bool {
+	base := filepath.Base(name)
+	if len(d.include) != 0 && !matchFileName(d.include, base) {
+		return false
+	}
+
+	return !matchFileName(d.exclude, base)
+}
+
+func (d *fileFinder) sort(files []foundFile) {
+	sort.SliceStable(files, func(i, j int) bool {
+		if d.byMtime && !files[i].mtime.Equal(files[j].mtime) {
+			return files[i].mtime.Before(files[j].mtime)
+		}
+
+		return files[i].name < files[j].name
+	})
+}
+
+func matchFileName(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasGlobMeta(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// walkRoot returns the root directory to walk. The trailing separator
+// makes filepath.Walk follow the root if it's a symlink.
+func walkRoot(dir string) string {
+	if strings.HasSuffix(dir, string(filepath.Separator)) {
+		return dir
+	}
+
+	return dir + string(filepath.Separator)
+}
+
+// regularFile returns info of the regular file or of the regular file the
+// symlink points to. Symlinks to directories are not followed to avoid
+// loops.
+func regularFile(path string, info os.FileInfo) (os.FileInfo, bool) {
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		info, err = os.Stat(path)
+		if err != nil {
+			return nil, false
+		}
+	}
+
+	return info, info.Mode().IsRegular()
+}
+
+// walkDir returns regular files of the directory and, if recursive is
+// true, of its subdirectories. Entries that can't be read are skipped.
+func walkDir(dir string, recursive bool) ([]foundFile, error) {
+	root := walkRoot(dir)
+	found := []foundFile{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		switch {
+		case err != nil && path == root:
+			return err
+		case err != nil:
+			return nil
+		case info.IsDir() && path != root && !recursive:
+			return filepath.SkipDir
+		}
+		if info, ok := regularFile(path, info); ok {
+			found = append(found, foundFile{path, info.ModTime()})
+		}
+
+		return nil
+	})
+
+	return found, err
+}
+
+// globFiles returns regular files matching the pattern. The directory
+// part of the pattern without meta characters is walked.
+func globFiles(pattern string) ([]foundFile, error) {
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	n := 0
+	for n < len(segments)-1 && !hasGlobMeta(segments[n]) {
+		n++
+	}
+	root := strings.Join(segments[:n], "/")
+	switch {
+	case n == 0:
+		root = "."
+	case root == "":
+		root = "/"
+	}
+	segments = segments[n:]
+
+	for _, s := range segments {
+		if _, err := filepath.Match(s, ""); err != nil {
+			return nil, fmt.Errorf("bad pattern %s: %s", pattern, err)
+		}
+	}
+
+	found := []foundFile{}
+	err := filepath.Walk(walkRoot(filepath.FromSlash(root)), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// The root may be missing, e.g. in follow mode.
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return nil
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+
+		if info.IsDir() {
+			if !matchGlobDir(segments, parts) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+		if !matchGlob(segments, parts) {
+			return nil
+		}
+		if info, ok := regularFile(path, info); ok {
+			found = append(found, foundFile{path, info.ModTime()})
+		}
+
+		return nil
+	})
+
+	return found, err
+}
+
+// matchGlob checks whether the path segments match the pattern segments.
+// The "**" segment matches any number of path segments.
+func matchGlob(pattern, parts []string) bool {
+	for len(pattern) != 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchGlob(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+
+	return len(parts) == 0
+}
+
+// matchGlobDir checks whether files of the directory with the given path
+// segments could match the pattern segments.
+func matchGlobDir(pattern, parts []string) bool {
+	for i, p := range parts {
+		if i >= len(pattern) {
+			return false
+		}
+		if pattern[i] == "**" {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern[i], p); !ok {
+			return false
+		}
+	}
+
+	return len(parts) < len(pattern)
+}
+
+// isBinaryFile checks whether the beginning of the file contains zero
+// bytes. Compressed files are checked after decompression.
+func isBinaryFile(name string) bool {
+	in, err := openInput(name)
+	if err != nil {
+		// The error is reported when the file is read.
+		return false
+	}
+	defer in.Close()
+
+	buf := make([]byte, binaryCheckSize)
+	n, _ := io.ReadFull(in, buf)
+
+	return bytes.IndexByte(buf[:n], 0) != -1
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"*.json", "a.json", true},
+		{"*.json", "d/a.json", false},
+		{"**/*.json", "a.json", true},
+		{"**/*.json", "d/e/a.json", true},
+		{"d/**/a.json", "d/a.json", true},
+		{"d/**/a.json", "x/e/a.json", false},
+		{"d/*/a.json", "d/e/f/a.json", false},
+	}
+	for _, c := range cases {
+		if matchGlob(strings.Split(c.pattern, "/"), strings.Split(c.path, "/")) != c.match {
+			t.Errorf("unexpected result for %q and %q", c.pattern, c.path)
+		}
+	}
+}
+
+func TestFileFinder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hlogf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"a.json":     "{}\n",
+		"b.log":      "text\n",
+		"bin.json":   "\x00\x01",
+		"d/c.json":   "{}\n",
+		"d/e/f.json": "{}\n",
+	}
+	for name, data := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(name), 0700)
+		if err == nil {
+			err = ioutil.WriteFile(name, []byte(data), 0600)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	relative := func(names []string) string {
+		for i := range names {
+			names[i], _ = filepath.Rel(dir, names[i])
+			names[i] = filepath.ToSlash(names[i])
+		}
+
+		return strings.Join(names, " ")
+	}
+
+	cases := []struct {
+		finder   fileFinder
+		operands []string
+		expected string
+	}{
+		{fileFinder{}, []string{dir}, "a.json b.log"},
+		{fileFinder{recursive: true}, []string{dir}, "a.json b.log d/c.json d/e/f.json"},
+		{fileFinder{exclude: []string{"*.log"}}, []string{dir}, "a.json"},
+		{fileFinder{include: []string{"*.json"}}, []string{dir + "/**/*"}, "a.json d/c.json d/e/f.json"},
+		{fileFinder{}, []string{dir + "/d/*.json", dir + "/**/*.json"}, "d/c.json a.json d/e/f.json"},
+	}
+	for _, c := range cases {
+		r, err := c.finder.expand(c.operands)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if relative(r) != c.expected {
+			t.Errorf("unexpected result for %v: %q, expected: %q", c.operands, relative(r), c.expected)
+		}
+	}
+
+	// Only new files are returned when called again.
+	finder := fileFinder{follow: true}
+	_, err = finder.expand([]string{dir + "/*.json", dir + "/new/*.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Mkdir(filepath.Join(dir, "new"), 0700)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "new", "g.json"), nil, 0600)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := finder.expand([]string{dir + "/*.json", dir + "/new/*.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if relative(r) != "new/g.json" {
+		t.Errorf("unexpected new files: %q", relative(r))
+	}
+
+	_, err = (&fileFinder{}).expand([]string{dir + "/*.none"})
+	if err == nil {
+		t.Error("expected error for a pattern without files")
+	}
+}
+
+func TestFileFinderSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	logs := filepath.Join(dir, "logs")
+	other := filepath.Join(dir, "other")
+	for _, d := range []string{logs, other} {
+		err := os.Mkdir(d, 0700)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{filepath.Join(logs, "a.json"), filepath.Join(logs, "app[1].log"), filepath.Join(other, "b.json")} {
+		err := ioutil.WriteFile(name, []byte("{}\n"), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		filepath.Join(logs, "b.json"):    filepath.Join(other, "b.json"),
+		filepath.Join(logs, "dead.json"): filepath.Join(other, "none.json"),
+		filepath.Join(logs, "other"):     other,
+		filepath.Join(dir, "current"):    logs,
+	}
+	for name, target := range links {
+		err := os.Symlink(target, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		finder   fileFinder
+		operands []string
+		expected string
+	}{
+		// Symlinks to files are followed, symlinks to directories are not
+		// walked.
+		{fileFinder{recursive: true}, []string{logs}, "logs/a.json logs/app[1].log logs/b.json"},
+		{fileFinder{}, []string{logs + "/*.json"}, "logs/a.json logs/b.json"},
+		{fileFinder{}, []string{dir + "/current"}, "current/a.json current/app[1].log current/b.json"},
+		{fileFinder{}, []string{dir + "/current/*.json"}, "current/a.json current/b.json"},
+
+		// An existing file is not a pattern.
+		{fileFinder{}, []string{logs + "/app[1].log"}, "logs/app[1].log"},
+		{fileFinder{}, []string{logs + "/app?1?.log"}, "logs/app[1].log"},
+	}
+	for _, c := range cases {
+		r, err := c.finder.expand(c.operands)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range r {
+			r[i], _ = filepath.Rel(dir, r[i])
+			r[i] = filepath.ToSlash(r[i])
+		}
+		if strings.Join(r, " ") != c.expected {
+			t.Errorf("unexpected result for %v: %q, expected: %q", c.operands, strings.Join(r, " "), c.expected)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// Prefix of environment variables with default values of options.
+const envPrefix = "HLOGF_"
+
+// Aliases of flags. They are accepted in the command line, in the config
+// file and as environment variables, but set the same flag, so the usual
+// precedence applies to them.
+var flagAliases = map[string]string{
+	"min-level": "level",
+}
+
+// normalizeFlagName maps aliases of flags to their names.
+func normalizeFlagName(_ *pflag.FlagSet, name string) pflag.NormalizedName {
+	if alias, ok := flagAliases[name]; ok {
+		name = alias
+	}
+
+	return pflag.NormalizedName(name)
+}
+
+// envName returns a name of the environment variable for the given flag,
+// e.g. HLOGF_TIME_FORMAT for --time-format.
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(flag, "-", "_", -1))
+}
+
+// envBound checks whether the flag could be specified with an environment
+// variable.
+func envBound(f *pflag.Flag) bool {
+	return f.Name != "help" && f.Name != "version"
+}
+
+// bindEnvUsage adds names of environment variables to usages of the flags.
+func bindEnvUsage(flags *pflag.FlagSet) {
+	flags.VisitAll(func(f *pflag.Flag) {
+		if envBound(f) {
+			f.Usage += fmt.Sprintf(" (env $%s)", envName(f.Name))
+		}
+	})
+}
+
+// applyEnv sets the flags that were not specified in the command line to
+// values of the corresponding environment variables. Empty variables are
+// ignored. Variables of aliases are used if the variable of the flag is
+// not set.
+func applyEnv(flags *pflag.FlagSet) error {
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || !envBound(f) {
+			return
+		}
+
+		name := envName(f.Name)
+		value := os.Getenv(name)
+		for alias, flag := range flagAliases {
+			if value == "" && flag == f.Name {
+				name = envName(alias)
+				value = os.Getenv(name)
+			}
+		}
+		if value == "" {
+			return
+		}
+
+		if setErr := flags.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("environment variable %s: %s", name, setErr)
+		}
+	})
+
+	return err
+}
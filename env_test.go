@@ -0,0 +1,178 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+// parseFlags parses the command line of the root command and applies
+// environment variables.
+func parseFlags(t *testing.T, args ...string) *pflag.FlagSet {
+	cmd := newRootCommand()
+	err := cmd.ParseFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = applyEnv(cmd.Flags())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cmd.Flags()
+}
+
+func TestLevelAlias(t *testing.T) {
+	cases := []struct {
+		env      map[string]string
+		args     []string
+		expected string
+	}{
+		{map[string]string{"HLOGF_MIN_LEVEL": "debug"}, []string{"--level", "warn"}, "warn"},
+		{map[string]string{"HLOGF_MIN_LEVEL": "debug"}, []string{"-l", "warn"}, "warn"},
+		{map[string]string{"HLOGF_LEVEL": "debug"}, []string{"--min-level", "warn"}, "warn"},
+		{map[string]string{"HLOGF_MIN_LEVEL": "error"}, nil, "error"},
+		{map[string]string{"HLOGF_LEVEL": "info", "HLOGF_MIN_LEVEL": "error"}, nil, "info"},
+	}
+
+	for i, c := range cases {
+		t.Setenv("HLOGF_LEVEL", "")
+		t.Setenv("HLOGF_MIN_LEVEL", "")
+		for k, v := range c.env {
+			t.Setenv(k, v)
+		}
+
+		flags := parseFlags(t, c.args...)
+		if r := flags.Lookup("level").Value.String(); r != c.expected {
+			t.Errorf("%d: unexpected level %q, expected %q", i, r, c.expected)
+		}
+		if flags.Lookup("min-level") != flags.Lookup("level") {
+			t.Errorf("%d: min-level is not an alias of level", i)
+		}
+	}
+}
+
+func TestLevelAliasConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	err := ioutil.WriteFile(path, []byte("min-level = \"debug\"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{{"--level", "warn"}, {"--min-level", "warn"}} {
+		flags := parseFlags(t, args...)
+		_, err := handleConfigOptions(flags, path, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r := flags.Lookup("level").Value.String(); r != "warn" {
+			t.Errorf("%v: unexpected level %q", args, r)
+		}
+	}
+
+	flags := parseFlags(t)
+	_, err = handleConfigOptions(flags, path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := flags.Lookup("level").Value.String(); r != "debug" {
+		t.Errorf("unexpected level from config %q", r)
+	}
+}
+
+func TestEnvPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	err := ioutil.WriteFile(path, []byte("time-format = \"config\"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		env      string
+		config   string
+		args     []string
+		expected string
+	}{
+		{"", "", nil, defaultTimeFormat},
+		{"", path, nil, "config"},
+		{"env", path, nil, "env"},
+		{"env", path, []string{"-t", "flag"}, "flag"},
+		{"", path, []string{"--time-format", "flag"}, "flag"},
+	}
+
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	for i, c := range cases {
+		t.Setenv("HLOGF_TIME_FORMAT", c.env)
+
+		// The environment is applied before the config file, the same as
+		// the root command does.
+		flags := parseFlags(t, c.args...)
+		_, err := handleConfigOptions(flags, c.config, "")
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if r := flags.Lookup("time-format").Value.String(); r != c.expected {
+			t.Errorf("%d: unexpected time format %q, expected %q", i, r, c.expected)
+		}
+	}
+}
+
+func TestEnvValues(t *testing.T) {
+	t.Setenv("HLOGF_FIELDS", "status,duration")
+	t.Setenv("HLOGF_NUMBER", "true")
+
+	flags := parseFlags(t)
+	fields, _ := flags.GetStringSlice("fields")
+	if len(fields) != 2 || fields[0] != "status" || fields[1] != "duration" {
+		t.Errorf("unexpected fields %q", fields)
+	}
+	if number, _ := flags.GetBool("number"); !number {
+		t.Error("number is not set")
+	}
+}
+
+func TestEnvErrors(t *testing.T) {
+	cases := []struct {
+		name  string
+		value string
+	}{
+		{"HLOGF_NUMBER", "maybe"},
+		{"HLOGF_BUFFER_SIZE", "big"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv(c.name, c.value)
+
+			cmd := newRootCommand()
+			err := cmd.ParseFlags(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = applyEnv(cmd.Flags())
+			if err == nil || !strings.Contains(err.Error(), "environment variable "+c.name) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestEnvUsage(t *testing.T) {
+	flags := newRootCommand().PersistentFlags()
+
+	if u := flags.Lookup("time-format").Usage; !strings.HasSuffix(u, " (env $HLOGF_TIME_FORMAT)") {
+		t.Errorf("unexpected usage of time-format: %q", u)
+	}
+	if u := flags.Lookup("level").Usage; !strings.HasSuffix(u, " (env $HLOGF_LEVEL)") {
+		t.Errorf("unexpected usage of level: %q", u)
+	}
+	for _, name := range []string{"help", "version"} {
+		f := flags.Lookup(name)
+		if f != nil && strings.Contains(f.Usage, "$HLOGF_") {
+			t.Errorf("unexpected usage of %s: %q", name, f.Usage)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"unicode"
 	"unicode/utf16"
 	"unicode/utf8"
@@ -25,6 +26,24 @@ func unescapeString(buf *logf.Buffer, data []byte) {
 	buf.AppendBytes(data[p:i])
 }
 
+// textValue returns a text representation of the given JSON value. Strings
+// are unquoted and unescaped, other values are returned as is. Memory is
+// allocated only if the string contains escape sequences.
+func textValue(val []byte) []byte {
+	if len(val) < 2 || val[0] != '"' {
+		return val
+	}
+	s := val[1 : len(val)-1]
+	if bytes.IndexByte(s, '\\') == -1 {
+		return s
+	}
+
+	buf := logf.NewBufferWithCapacity(len(s))
+	unescapeString(buf, s)
+
+	return buf.Bytes()
+}
+
 // handleEscapeSequence handles a single escape sequence.
 func handleEscapeSequence(buf *logf.Buffer, data []byte) int {
 	if len(data) < 2 {
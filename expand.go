@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"github.com/ssgreg/logf"
+)
+
+// Indentation of fields in the expanded layout.
+const expandIndent = "    "
+
+// expandPolicy defines which entries are printed in the expanded layout.
+type expandPolicy struct {
+	always bool
+
+	// Entries with at least fields fields or with lines longer than
+	// width characters are expanded. Zero disables the check. If any
+	// check is enabled, entries with multi-line values are expanded too.
+	fields int
+	width  int
+}
+
+// check checks whether the entry formatted as the given line with the
+// given number of fields should be expanded.
+func (p expandPolicy) check(line []byte, fields int) bool {
+	if p.fields == 0 && p.width == 0 {
+		return false
+	}
+	if p.fields != 0 && fields >= p.fields {
+		return true
+	}
+	if i := bytes.IndexByte(line, '\n'); i != -1 && i != len(line)-1 {
+		return true
+	}
+
+	return p.width != 0 && visibleWidth(line) > p.width
+}
+
+// formatExpanded formats the entry on several lines: the header line with
+// time, level, logger name, message and caller is followed by indented
+// fields, one per line:
+//
+//	Dec 13 22:21:26.849 |ERRO| token: request failed @token/resource.go:66
+//	    status: 500
+//	    stack:  goroutine 1 [running]:
+//	            main.main()
+//
+// Keys are aligned, lines of multi-line values are indented under the
+// first one. String values are printed without quotes.
+func (f *formatter) formatExpanded(buf *logf.Buffer, e *Entry, fields []Field) {
+	start := buf.Len()
+	f.appendHeader(buf, e)
+	f.indentLines(buf, start, len(expandIndent))
+	f.appendCaller(buf, e)
+	buf.AppendByte('\n')
+
+	width := 0
+	for _, field := range fields {
+		if w := utf8.RuneCount(field.Key); w > width {
+			width = w
+		}
+	}
+
+	for _, field := range fields {
+		buf.AppendString(expandIndent)
+		f.appendKey(buf, field.Key)
+		f.theme.Separator.at(buf, func() {
+			buf.AppendByte(':')
+		})
+		for i := utf8.RuneCount(field.Key); i <= width; i++ {
+			buf.AppendByte(' ')
+		}
+
+		valueStart := buf.Len()
+		if isTrace(field) {
+			f.appendTrace(buf, field.Value)
+		} else {
+			f.appendValue(buf, field, true)
+		}
+		f.indentLines(buf, valueStart, len(expandIndent)+width+2)
+		buf.AppendByte('\n')
+	}
+}
+
+// indentLines indents all lines of the buffer after the first one starting
+// from the given position. Trailing line breaks are removed.
+func (f *formatter) indentLines(buf *logf.Buffer, start, indent int) {
+	if bytes.IndexByte(buf.Data[start:], '\n') == -1 {
+		return
+	}
+
+	data := buf.Data[start:]
+	reset := bytes.HasSuffix(data, []byte(escReset))
+	if reset {
+		data = data[:len(data)-len(escReset)]
+	}
+	data = bytes.TrimRight(data, "\n")
+
+	f.scratch = append(f.scratch[:0], data...)
+	buf.Data = buf.Data[:start]
+	for _, c := range f.scratch {
+		buf.AppendByte(c)
+		if c == '\n' {
+			for i := 0; i < indent; i++ {
+				buf.AppendByte(' ')
+			}
+		}
+	}
+	if reset {
+		buf.AppendString(escReset)
+	}
+}
+
+// visibleWidth returns the number of characters of the line excluding
+// escape sequences and the trailing line break.
+func visibleWidth(line []byte) int {
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+
+	n := 0
+	for i := 0; i < len(line); {
+		if line[i] == '\x1b' && i+1 < len(line) && line[i+1] == '[' {
+			// Skip a CSI sequence up to the final byte.
+			i += 2
+			for i < len(line) && (line[i] < 0x40 || line[i] > 0x7e) {
+				i++
+			}
+			i++
+
+			continue
+		}
+
+		_, size := utf8.DecodeRune(line[i:])
+		i += size
+		n++
+	}
+
+	return n
+}
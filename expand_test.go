@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ssgreg/logf"
+)
+
+func TestFormatExpanded(t *testing.T) {
+	var e Entry
+	if !parse([]byte(`{"ts":"2024-01-01T10:00:00Z","level":"error","msg":"boom","status":500,"query":"SELECT 1\n\tFROM t\n"}`), defaultFieldMapping, &e) {
+		t.Fatal("failed to parse")
+	}
+	adoptEntry(&e)
+
+	f := newFormatter(Options{NoColor: true, TimeFormat: "15:04Z07:00", Expand: expandPolicy{always: true}})
+	buf := logf.NewBuffer()
+	f.format(buf, &e)
+
+	expected := "10:00Z |ERRO| boom\n" +
+		"    status: 500\n" +
+		"    query:  SELECT 1\n" +
+		"            \tFROM t\n"
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestVisibleWidth(t *testing.T) {
+	if w := visibleWidth([]byte("\x1b[32mkey\x1b[0m=значение\n")); w != 12 {
+		t.Errorf("expected 12, got %d", w)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+)
+
+// fieldSelector selects fields of an entry to print and orders them.
+// All lists contain glob patterns where '*' matches any sequence of
+// characters and '?' matches any single character.
+type fieldSelector struct {
+	// If only is not empty, only the matching fields are printed in the
+	// order of the patterns.
+	only []string
+	hide []string
+
+	// Pinned fields are printed first in the order of the patterns.
+	pin []string
+
+	// Fields are sorted by key unless only is specified.
+	sort bool
+}
+
+// enabled checks whether the selector changes fields at all.
+func (s *fieldSelector) enabled() bool {
+	return s != nil && (len(s.only) != 0 || len(s.hide) != 0 || len(s.pin) != 0 || s.sort)
+}
+
+// hidden checks whether the field is hidden.
+func (s *fieldSelector) hidden(f Field) bool {
+	if matchFieldAny(s.hide, f) {
+		return true
+	}
+
+	return len(s.only) != 0 && !matchFieldAny(s.only, f)
+}
+
+// apply appends the selected fields to dst in the required order.
+func (s *fieldSelector) apply(fields []Field, dst []Field) []Field {
+	start := len(dst)
+
+	// Pinned fields.
+	for _, pattern := range s.pin {
+		for _, f := range fields {
+			if matchField(pattern, f) && !s.hidden(f) && !containsField(dst[start:], f) {
+				dst = append(dst, f)
+			}
+		}
+	}
+	pinned := len(dst)
+
+	// The rest of the fields.
+	if len(s.only) != 0 {
+		for _, pattern := range s.only {
+			for _, f := range fields {
+				if matchField(pattern, f) && !matchFieldAny(s.hide, f) && !containsField(dst[start:], f) {
+					dst = append(dst, f)
+				}
+			}
+		}
+
+		return dst
+	}
+
+	for _, f := range fields {
+		if !s.hidden(f) && !containsField(dst[start:pinned], f) {
+			dst = append(dst, f)
+		}
+	}
+	if s.sort {
+		sortFields(dst[pinned:])
+	}
+
+	return dst
+}
+
+// containsField checks whether the field is in the list. Fields are
+// compared by their position in the source entry.
+func containsField(fields []Field, f Field) bool {
+	for _, v := range fields {
+		if len(v.Key) != 0 && len(f.Key) != 0 && &v.Key[0] == &f.Key[0] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sortFields sorts fields by key. Insertion sort is used as it's stable
+// and does not allocate memory. The number of fields is usually small.
+func sortFields(fields []Field) {
+	for i := 1; i < len(fields); i++ {
+		for j := i; j > 0 && bytes.Compare(fields[j-1].Key, fields[j].Key) > 0; j-- {
+			fields[j-1], fields[j] = fields[j], fields[j-1]
+		}
+	}
+}
+
+// matchField checks whether the field matches the pattern. A nested object
+// that is not flattened matches patterns of its keys ending with ".*", e.g.
+// "http" object matches "http.*", so it's hidden or shown as a whole.
+func matchField(pattern string, f Field) bool {
+	key := bytesToString(f.Key)
+	if globMatch(pattern, key) {
+		return true
+	}
+
+	return len(f.Value) != 0 && f.Value[0] == '{' && strings.HasSuffix(pattern, ".*") &&
+		globMatch(pattern[:len(pattern)-2], key)
+}
+
+func matchFieldAny(patterns []string, f Field) bool {
+	for _, p := range patterns {
+		if matchField(p, f) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if globMatch(p, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// globMatch checks whether s matches the pattern. The '*' matches any
+// sequence of characters, including '.' and '/', and '?' matches any
+// single character.
+func globMatch(pattern, s string) bool {
+	// Positions to return to on mismatch after the last '*'.
+	star, next := -1, 0
+
+	p, i := 0, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, next = p, i
+			p++
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case star != -1:
+			next++
+			p, i = star+1, next
+		default:
+			return false
+		}
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern  string
+		s        string
+		expected bool
+	}{
+		{"pid", "pid", true},
+		{"pid", "ppid", false},
+		{"http.*", "http.status", true},
+		{"http.*", "http", false},
+		{"*id", "request-id", true},
+		{"*-*-id", "x-request-id", true},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"*", "", true},
+		{"a*b*c", "abxbxc", true},
+		{"a*b*c", "abxbx", false},
+	}
+
+	for _, c := range cases {
+		if r := globMatch(c.pattern, c.s); r != c.expected {
+			t.Errorf("%q %q: expected %v, got %v", c.pattern, c.s, c.expected, r)
+		}
+	}
+}
+
+func TestFieldSelector(t *testing.T) {
+	var e Entry
+	if !parse([]byte(`{"msg":"m","pid":1,"http.status":200,"http.path":"/","request-id":"r","b":2,"a":3}`), defaultFieldMapping, &e) {
+		t.Fatal("failed to parse")
+	}
+
+	cases := []struct {
+		s        fieldSelector
+		expected string
+	}{
+		{fieldSelector{hide: []string{"http.*"}}, "pid request-id b a"},
+		{fieldSelector{pin: []string{"request-id"}}, "request-id pid http.status http.path b a"},
+		{fieldSelector{pin: []string{"request-id"}, sort: true}, "request-id a b http.path http.status pid"},
+		{fieldSelector{only: []string{"a", "http.*", "missing"}}, "a http.status http.path"},
+		{fieldSelector{only: []string{"a", "http.*"}, hide: []string{"http.path"}, pin: []string{"http.status"}}, "http.status a"},
+	}
+
+	for _, c := range cases {
+		var keys []string
+		for _, f := range c.s.apply(e.Fields, nil) {
+			keys = append(keys, string(f.Key))
+		}
+		if r := strings.Join(keys, " "); r != c.expected {
+			t.Errorf("%+v: expected %q, got %q", c.s, c.expected, r)
+		}
+	}
+}
+
+func TestFieldSelectorNested(t *testing.T) {
+	var e Entry
+	if !parse([]byte(`{"msg":"m","http":{"status":200},"httpd":{"a":1},"db":{"q":"x"},"grpc":"x","a":1}`), defaultFieldMapping, &e) {
+		t.Fatal("failed to parse")
+	}
+
+	cases := []struct {
+		s        fieldSelector
+		expected string
+	}{
+		{fieldSelector{hide: []string{"http.*"}}, "httpd db grpc a"},
+		{fieldSelector{hide: []string{"http*.*"}}, "db grpc a"},
+		{fieldSelector{hide: []string{"grpc.*", "db.q"}}, "http httpd db grpc a"},
+		{fieldSelector{only: []string{"db.*", "a"}}, "db a"},
+		{fieldSelector{pin: []string{"db.*"}}, "db http httpd grpc a"},
+	}
+
+	for _, c := range cases {
+		var keys []string
+		for _, f := range c.s.apply(e.Fields, nil) {
+			keys = append(keys, string(f.Key))
+		}
+		if r := strings.Join(keys, " "); r != c.expected {
+			t.Errorf("%+v: expected %q, got %q", c.s, c.expected, r)
+		}
+	}
+
+	// Flattened fields are matched by their keys.
+	f := newFormatter(Options{NoColor: true, FlattenDepth: 1, Fields: &fieldSelector{hide: []string{"http.*"}}})
+	var keys []string
+	for _, field := range f.fieldsOf(&e) {
+		keys = append(keys, string(field.Key))
+	}
+	if r := strings.Join(keys, " "); r != "httpd.a db.q grpc a" {
+		t.Errorf("unexpected flattened fields %q", r)
+	}
+}
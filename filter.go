@@ -0,0 +1,42 @@
+package main
+
+// Filter decides whether an entry should be printed.
+//
+// Filters are called from several formatter goroutines at once so they
+// must be safe for concurrent use.
+type Filter interface {
+	Match(e *Entry) bool
+}
+
+// Filters combines several filters. It matches an entry if all of the
+// filters match it.
+type Filters []Filter
+
+// Match implements Filter.
+func (fs Filters) Match(e *Entry) bool {
+	for _, f := range fs {
+		if !f.Match(e) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// MatchRaw checks lines that are not parsed as entries. Only filters that
+// implement rawFilter are taken into account.
+func (fs Filters) MatchRaw(data []byte) bool {
+	for _, f := range fs {
+		if rf, ok := f.(rawFilter); ok && !rf.MatchRaw(data) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// rawFilter is implemented by filters that are able to check lines that
+// are not parsed as entries. Such lines are shown by default.
+type rawFilter interface {
+	MatchRaw(data []byte) bool
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	// Interval between checks for new data in follow mode.
+	followPollInterval = 250 * time.Millisecond
+
+	// Size of the chunk follower reads from a file at once.
+	followChunkSize = 32 * 1024
+
+	// Interval between checks for new files in follow mode.
+	followDiscoverInterval = 2 * time.Second
+
+	// Size of the data before the read offset that is kept to detect
+	// truncation.
+	followTailSize = 64
+)
+
+// fileFollower reads a single file and tracks its truncation and rotation.
+//
+// A file truncated in place could be written again past the read offset
+// before the truncation is noticed. So the data before the offset is
+// remembered and compared with the file whenever its size or modification
+// time changes.
+type fileFollower struct {
+	name   string
+	reopen bool
+	f      *os.File
+	offset int64
+	next   *os.File
+
+	tail  []byte
+	size  int64
+	mtime time.Time
+	atEnd bool
+
+	// restarted is set when the beginning of the file or of a new file is
+	// read, so an incomplete line of the previous data is not continued.
+	restarted bool
+}
+
+// errNotFollowable is returned for files that can't be followed as they
+// are not read as is, i.e. compressed and journal files.
+var errNotFollowable = errors.New("can't be followed")
+
+func openFileFollower(name string, reopen bool) (*fileFollower, error) {
+	if isJournalFile(name) {
+		return nil, fmt.Errorf("%s: journal file %w", name, errNotFollowable)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, compressionHeadSize)
+	n, _ := f.ReadAt(head, 0)
+	if c, ok := compressionOf(head[:n]); ok {
+		_ = f.Close()
+
+		return nil, fmt.Errorf("%s: %s file %w", name, c.name, errNotFollowable)
+	}
+
+	return &fileFollower{name: name, reopen: reopen, f: f}, nil
+}
+
+// read reads available data from the file. It returns 0 and no error if
+// there is no data to read at the moment.
+func (ff *fileFollower) read(p []byte) (int, error) {
+	if ff.atEnd {
+		// New data could be written after truncation.
+		ff.atEnd = false
+		fi, err := ff.f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		if ff.truncated(fi) {
+			err = ff.restart()
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	for {
+		n, err := ff.f.Read(p)
+		ff.offset += int64(n)
+		if n > 0 {
+			ff.remember(p[:n])
+
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		// The end of the current file is reached. Switch to the new file
+		// if the old one was rotated and is fully read.
+		if ff.next != nil {
+			_ = ff.f.Close()
+			ff.f, ff.next, ff.offset = ff.next, nil, 0
+			ff.tail = ff.tail[:0]
+			ff.restarted = true
+
+			continue
+		}
+
+		changed, err := ff.check()
+		if err != nil || !changed {
+			ff.atEnd = true
+
+			return 0, err
+		}
+	}
+}
+
+// remember keeps the end of the read data.
+func (ff *fileFollower) remember(data []byte) {
+	if len(data) > followTailSize {
+		data = data[len(data)-followTailSize:]
+	}
+	ff.tail = append(ff.tail, data...)
+	if len(ff.tail) > followTailSize {
+		ff.tail = ff.tail[:copy(ff.tail, ff.tail[len(ff.tail)-followTailSize:])]
+	}
+}
+
+// truncated checks whether the file was truncated since the last check.
+func (ff *fileFollower) truncated(fi os.FileInfo) bool {
+	if fi.Size() < ff.offset {
+		return true
+	}
+	if fi.Size() == ff.size && fi.ModTime().Equal(ff.mtime) {
+		return false
+	}
+	ff.size, ff.mtime = fi.Size(), fi.ModTime()
+	if len(ff.tail) == 0 {
+		return false
+	}
+
+	data := make([]byte, len(ff.tail))
+	_, err := ff.f.ReadAt(data, ff.offset-int64(len(ff.tail)))
+
+	return err != nil || !bytes.Equal(data, ff.tail)
+}
+
+// restart starts reading the file from the beginning.
+func (ff *fileFollower) restart() error {
+	_, err := ff.f.Seek(0, io.SeekStart)
+	ff.offset = 0
+	ff.tail = ff.tail[:0]
+	ff.restarted = true
+
+	return err
+}
+
+// check checks whether the file was truncated or replaced with a new one.
+// It returns true if there could be new data to read.
+func (ff *fileFollower) check() (bool, error) {
+	fi, err := ff.f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	if ff.truncated(fi) {
+		// The file was truncated in place, e.g. by logrotate with
+		// 'copytruncate' option. Start reading from the beginning.
+		err = ff.restart()
+
+		return err == nil, err
+	}
+
+	if !ff.reopen {
+		return false, nil
+	}
+
+	nfi, err := os.Stat(ff.name)
+	if err != nil || os.SameFile(fi, nfi) {
+		// The file is the same or it was moved away and is not yet
+		// recreated. Keep waiting.
+		return false, nil
+	}
+
+	next, err := os.Open(ff.name)
+	if err != nil {
+		return false, nil
+	}
+	// The old file could be appended after the last read. Drain it
+	// before switching to the new one.
+	ff.next = next
+
+	return true, nil
+}
+
+func (ff *fileFollower) Close() error {
+	if ff.next != nil {
+		_ = ff.next.Close()
+	}
+
+	return ff.f.Close()
+}
+
+// follower is an io.Reader that reads the given files and waits for new
+// data when all of them are read, the same as 'tail -f' does.
+//
+// Files are read in command-line order until there's no more data in the
+// current one. Only complete lines are returned so lines from different
+// files are never mixed.
+//
+// If discover is set, it's called periodically and the new files it
+// returns are followed as well, from the beginning.
+type follower struct {
+	files   []*fileFollower
+	pending [][]byte
+	out     []byte
+	chunk   []byte
+	cur     int
+	idle    int
+	maxLine int
+	pid     int
+	reopen  bool
+	exiting bool
+
+	discover     func() []string
+	discoveredAt time.Time
+
+	// Discovered files that couldn't be opened. They are retried on the
+	// next discovery as discover returns only new files.
+	retry []string
+}
+
+// newFollower opens the given files for following. If reopen is true
+// files are reopened by name when rotated. If pid is not zero, follower
+// returns io.EOF after the process with the given pid dies.
+func newFollower(names []string, reopen bool, pid int, maxLine int) (*follower, error) {
+	fr := &follower{
+		chunk:        make([]byte, followChunkSize),
+		maxLine:      maxLine,
+		pid:          pid,
+		reopen:       reopen,
+		discoveredAt: time.Now(),
+	}
+
+	for _, name := range names {
+		err := fr.add(name)
+		if err != nil {
+			_ = fr.Close()
+
+			return nil, err
+		}
+	}
+
+	return fr, nil
+}
+
+// add opens the file for following.
+func (fr *follower) add(name string) error {
+	ff, err := openFileFollower(name, fr.reopen)
+	if err != nil {
+		return err
+	}
+	fr.files = append(fr.files, ff)
+	fr.pending = append(fr.pending, nil)
+
+	return nil
+}
+
+// checkNewFiles adds new files returned by discover if it's time to.
+// Files that can't be opened are retried next time. Compressed and
+// journal files are skipped with a warning.
+func (fr *follower) checkNewFiles() {
+	if fr.discover == nil || time.Since(fr.discoveredAt) < followDiscoverInterval {
+		return
+	}
+	fr.discoveredAt = time.Now()
+
+	names := append(fr.retry, fr.discover()...)
+	fr.retry = nil
+	for _, name := range names {
+		err := fr.add(name)
+		switch {
+		case err == nil:
+		case errors.Is(err, errNotFollowable):
+			_, _ = fmt.Fprintf(os.Stderr, "hlogf: %s, skipped\n", err)
+		default:
+			fr.retry = append(fr.retry, name)
+		}
+	}
+}
+
+func (fr *follower) Read(p []byte) (int, error) {
+	for len(fr.out) == 0 {
+		if fr.idle >= len(fr.files) {
+			// There's no new data in all files.
+			fr.idle = 0
+			if fr.exiting {
+				return fr.flush(p)
+			}
+			if fr.pid != 0 && !processExists(fr.pid) {
+				// Read all files once more before exit.
+				fr.exiting = true
+
+				continue
+			}
+
+			time.Sleep(followPollInterval)
+			fr.checkNewFiles()
+			if len(fr.files) == 0 {
+				continue
+			}
+		}
+
+		ff := fr.files[fr.cur]
+		n, err := ff.read(fr.chunk)
+		if err != nil {
+			return 0, err
+		}
+		if ff.restarted {
+			// The incomplete line is not continued by the new data.
+			ff.restarted = false
+			fr.takeIncomplete(fr.cur)
+		}
+		if n == 0 {
+			fr.idle++
+			fr.cur = (fr.cur + 1) % len(fr.files)
+
+			continue
+		}
+		fr.idle = 0
+
+		fr.pending[fr.cur] = append(fr.pending[fr.cur], fr.chunk[:n]...)
+		fr.takeLines(fr.cur)
+	}
+
+	n := copy(p, fr.out)
+	fr.out = fr.out[n:]
+
+	return n, nil
+}
+
+// takeLines moves complete lines of the i-th file to the output.
+func (fr *follower) takeLines(i int) {
+	data := fr.pending[i]
+
+	end := bytes.LastIndexByte(data, '\n') + 1
+	if end == 0 && len(data) >= fr.maxLine {
+		// The line is too long. Let the scanner deal with it.
+		end = len(data)
+	}
+
+	fr.out = append(fr.out, data[:end]...)
+	fr.pending[i] = append(data[:0], data[end:]...)
+}
+
+// takeIncomplete moves an incomplete line of the i-th file to the output
+// as a complete one.
+func (fr *follower) takeIncomplete(i int) {
+	if len(fr.pending[i]) != 0 {
+		fr.out = append(fr.out, fr.pending[i]...)
+		fr.out = append(fr.out, '\n')
+		fr.pending[i] = fr.pending[i][:0]
+	}
+}
+
+// flush returns incomplete lines that are left when following is over.
+func (fr *follower) flush(p []byte) (int, error) {
+	for i := range fr.pending {
+		fr.takeIncomplete(i)
+	}
+	if len(fr.out) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p, fr.out)
+	fr.out = fr.out[n:]
+
+	return n, nil
+}
+
+// Close closes all followed files.
+func (fr *follower) Close() error {
+	for _, ff := range fr.files {
+		_ = ff.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readAvailable reads all data that is available in the file at the moment.
+func readAvailable(t *testing.T, ff *fileFollower) string {
+	var r []byte
+	buf := make([]byte, 4)
+	for {
+		n, err := ff.read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			return string(r)
+		}
+		r = append(r, buf[:n]...)
+	}
+}
+
+// deadPid returns a pid of a process that is already finished.
+func deadPid(t *testing.T) int {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	err := cmd.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cmd.Process.Pid
+}
+
+func tempLog(t *testing.T, data string) (string, func()) {
+	dir, err := ioutil.TempDir("", "hlogf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "app.log")
+	writeLog(t, name, data, os.O_CREATE|os.O_TRUNC)
+
+	return name, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func writeLog(t *testing.T, name, data string, flag int) {
+	f, err := os.OpenFile(name, os.O_WRONLY|flag, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteString(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+}
+
+func TestFileFollowerAppend(t *testing.T) {
+	name, cleanup := tempLog(t, "one\n")
+	defer cleanup()
+
+	ff, err := openFileFollower(name, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ff.Close()
+
+	if r := readAvailable(t, ff); r != "one\n" {
+		t.Errorf("unexpected data: %q", r)
+	}
+	writeLog(t, name, "two\n", os.O_APPEND)
+	if r := readAvailable(t, ff); r != "two\n" {
+		t.Errorf("unexpected appended data: %q", r)
+	}
+}
+
+func TestFileFollowerTruncate(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+	}{
+		{"shorter", "new\n"},
+		{"longer", `{"msg":"five-trunc"}` + "\n"},
+	}
+
+	for _, c := range cases {
+		name, cleanup := tempLog(t, "first line\n")
+
+		ff, err := openFileFollower(name, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		readAvailable(t, ff)
+
+		// The new data is written before the follower notices truncation.
+		writeLog(t, name, c.data, os.O_TRUNC)
+		if r := readAvailable(t, ff); r != c.data {
+			t.Errorf("%s: unexpected data after truncation: %q", c.name, r)
+		}
+		if !ff.restarted {
+			t.Errorf("%s: expected restart", c.name)
+		}
+
+		_ = ff.Close()
+		cleanup()
+	}
+}
+
+func TestFileFollowerReopen(t *testing.T) {
+	name, cleanup := tempLog(t, "old\n")
+	defer cleanup()
+
+	ff, err := openFileFollower(name, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ff.Close()
+	readAvailable(t, ff)
+
+	err = os.Rename(name, name+".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLog(t, name+".1", "old appended\n", os.O_APPEND)
+	writeLog(t, name, "new\n", os.O_CREATE)
+
+	// The rest of the old file is read before the new one.
+	if r := readAvailable(t, ff); r != "old appended\nnew\n" {
+		t.Errorf("unexpected data after rename: %q", r)
+	}
+}
+
+func TestFollowerPartialLines(t *testing.T) {
+	name, cleanup := tempLog(t, "one\nold partial")
+	defer cleanup()
+
+	fr, err := newFollower([]string{name}, true, deadPid(t), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fr.Close()
+
+	// The file is replaced before it's read, the incomplete line of the
+	// old file is not joined with the new one.
+	err = os.Rename(name, name+".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLog(t, name, "new\nnew partial", os.O_CREATE)
+
+	r, err := ioutil.ReadAll(fr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(r) != "one\nold partial\nnew\nnew partial\n" {
+		t.Errorf("unexpected data: %q", r)
+	}
+}
+
+func TestFollowerPidExit(t *testing.T) {
+	name, cleanup := tempLog(t, "one\ntwo\n")
+	defer cleanup()
+
+	fr, err := newFollower([]string{name}, false, deadPid(t), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fr.Close()
+
+	done := make(chan []byte)
+	go func() {
+		r, _ := ioutil.ReadAll(fr)
+		done <- r
+	}()
+
+	select {
+	case r := <-done:
+		if string(r) != "one\ntwo\n" {
+			t.Errorf("unexpected data: %q", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("follower didn't stop after the process exit")
+	}
+}
+
+func TestFollowNotFollowable(t *testing.T) {
+	name, cleanup := tempLog(t, "")
+	defer cleanup()
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	_, _ = w.Write([]byte("one\n"))
+	_ = w.Close()
+	writeLog(t, name, gz.String(), os.O_TRUNC)
+
+	journal := filepath.Join(filepath.Dir(name), "system.journal")
+	writeLog(t, journal, "", os.O_CREATE)
+
+	for _, file := range []string{name, journal} {
+		_, err := newFollower([]string{file}, false, 0, 1024)
+		if !errors.Is(err, errNotFollowable) {
+			t.Errorf("%s: unexpected error %v", file, err)
+		}
+	}
+}
+
+func TestFollowerRetryNewFiles(t *testing.T) {
+	name, cleanup := tempLog(t, "one\n")
+	defer cleanup()
+	next := filepath.Join(filepath.Dir(name), "next.log")
+
+	fr, err := newFollower([]string{name}, false, 0, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fr.Close()
+
+	// The new file is returned once, but it can't be opened yet.
+	discovered := []string{next}
+	fr.discover = func() []string {
+		r := discovered
+		discovered = nil
+
+		return r
+	}
+	discover := func() {
+		fr.discoveredAt = time.Time{}
+		fr.checkNewFiles()
+	}
+
+	discover()
+	if len(fr.files) != 1 || len(fr.retry) != 1 {
+		t.Fatalf("unexpected files %d and retried files %v", len(fr.files), fr.retry)
+	}
+
+	writeLog(t, next, "two\n", os.O_CREATE)
+	discover()
+	if len(fr.files) != 2 || len(fr.retry) != 0 {
+		t.Errorf("unexpected files %d and retried files %v", len(fr.files), fr.retry)
+	}
+}
@@ -1,24 +1,273 @@
 package main
 
 import (
+	"fmt"
+	"regexp"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/ssgreg/logf"
-	"github.com/ssgreg/logftext"
 )
 
-func format(buf *logf.Buffer, eseq logftext.EscapeSequence, e *Entry, timeFormat string) {
+// outputFormat is a format of printed entries.
+type outputFormat int8
+
+const (
+	outputText outputFormat = iota
+	outputLogfmt
+	outputJSON
+)
+
+func parseOutputFormat(s string) (outputFormat, error) {
+	switch strings.ToLower(s) {
+	case "text":
+		return outputText, nil
+	case "logfmt":
+		return outputLogfmt, nil
+	case "json":
+		return outputJSON, nil
+	}
+
+	return outputText, fmt.Errorf("unknown output format %q, expected one of text, logfmt, json", s)
+}
+
+// formatter formats parsed entries. It is not safe for concurrent use,
+// each formatter goroutine has its own one.
+type formatter struct {
+	output     outputFormat
+	theme      *theme
+	timeFormat string
+
+	// highlight marks matched text in the message and field values. If
+	// highlightKey is not empty, only the value of the field with the
+	// given key is highlighted.
+	highlight       *regexp.Regexp
+	highlightMsg    bool
+	highlightFields bool
+	highlightKey    string
+
+	expand expandPolicy
+
+	// Source labels are padded to sourceWidth to be shown as a column.
+	sourceWidth int
+
+	// fields selects and orders fields to print, selected is reused
+	// for the result.
+	fields   *fieldSelector
+	selected []Field
+
+	// If flattenDepth is not zero, nested objects are flattened into
+	// fields with dotted keys up to the given depth. The keys arena and
+	// flat are reused for the result.
+	flattenDepth int
+	keys         []byte
+	flat         []Field
+
+	// key is reused for keys of fields that are renamed on output.
+	key []byte
+
+	scratch []byte
+}
+
+func newFormatter(opts Options) *formatter {
+	f := &formatter{
+		output:      opts.Output,
+		theme:       opts.Theme,
+		timeFormat:  opts.TimeFormat,
+		expand:      opts.Expand,
+		sourceWidth: opts.SourceWidth,
+	}
+	if f.output != outputJSON {
+		// Normalized JSON keeps the structure of values.
+		f.flattenDepth = opts.FlattenDepth
+	}
+	if opts.Fields.enabled() {
+		f.fields = opts.Fields
+	}
+	if opts.NoColor || f.theme == nil || f.output == outputJSON {
+		f.theme = &theme{}
+	}
+	if opts.Grep != nil && !opts.NoColor {
+		f.highlight = opts.Grep.re
+		switch {
+		case opts.Grep.key == "":
+			f.highlightMsg = true
+			f.highlightFields = true
+		case opts.Grep.path.role == roleMsg:
+			f.highlightMsg = true
+		case opts.Grep.path.role == roleNone:
+			f.highlightFields = true
+			f.highlightKey = opts.Grep.key
+		}
+	}
+
+	return f
+}
+
+func (f *formatter) format(buf *logf.Buffer, e *Entry) {
+	switch f.output {
+	case outputLogfmt:
+		f.formatLogfmt(buf, e)
+	case outputJSON:
+		f.formatJSON(buf, e)
+	default:
+		f.formatText(buf, e)
+	}
+}
+
+// fieldsOf returns the fields of the entry to print.
+func (f *formatter) fieldsOf(e *Entry) []Field {
+	fields := e.Fields
+	if f.flattenDepth != 0 {
+		f.flat = f.flattenFields(fields, f.flat[:0])
+		fields = f.flat
+	}
+	if f.fields == nil {
+		return fields
+	}
+	f.selected = f.fields.apply(fields, f.selected[:0])
+
+	return f.selected
+}
+
+// Prefix of fields named the same as keys of the entry's own values in
+// logfmt and JSON outputs, e.g. of a "time" field when the time is taken
+// from "ts". The same prefix is used by logrus for such fields.
+const clashingFieldPrefix = "fields."
+
+// fieldKey returns the key to print the field with in logfmt and JSON
+// outputs. Keys that clash with keys of the entry's own values are
+// prefixed, so the output has no duplicate keys.
+func (f *formatter) fieldKey(e *Entry, key []byte) []byte {
+	var clash bool
+	switch string(key) {
+	case "source":
+		clash = len(e.Source) != 0
+	case "time":
+		clash = len(e.Time) != 0
+	case "level":
+		clash = e.Severity != SeverityUnknown || len(e.Level) != 0
+	case "logger":
+		clash = len(e.Name) != 0
+	case "msg":
+		clash = len(e.Msg) != 0
+	case "caller":
+		clash = len(e.Caller) != 0
+	}
+	if !clash {
+		return key
+	}
+
+	f.key = append(append(f.key[:0], clashingFieldPrefix...), key...)
+
+	return f.key
+}
+
+// formatRaw formats a line that is not parsed as an entry. The source
+// label of the line is printed before it if not empty.
+func (f *formatter) formatRaw(buf *logf.Buffer, data, source []byte) {
+	if f.output == outputJSON {
+		formatRawJSON(buf, data, source)
+
+		return
+	}
+
+	if len(source) != 0 {
+		f.appendSource(buf, source)
+		buf.AppendByte(' ')
+	}
+	buf.AppendBytes(data)
+	buf.AppendByte('\n')
+}
+
+// formatText formats the entry for humans. The entry is printed on a
+// single line unless it should be expanded.
+func (f *formatter) formatText(buf *logf.Buffer, e *Entry) {
+	fields := f.fieldsOf(e)
+	if f.expand.always {
+		f.formatExpanded(buf, e, fields)
+
+		return
+	}
+
+	start := buf.Len()
+	f.formatLine(buf, e, fields)
+	if f.expand.check(buf.Data[start:], len(fields)) {
+		buf.Data = buf.Data[:start]
+		f.formatExpanded(buf, e, fields)
+	}
+}
+
+// formatLine formats the entry on a single line.
+func (f *formatter) formatLine(buf *logf.Buffer, e *Entry, fields []Field) {
+	f.appendHeader(buf, e)
+
+	// Fields. Stack traces and errors are printed after the line.
+	traces := false
+	for _, field := range fields {
+		if isTrace(field) {
+			traces = true
+
+			continue
+		}
+
+		buf.AppendByte(' ')
+		f.appendKey(buf, field.Key)
+		f.theme.Separator.at(buf, func() {
+			buf.AppendByte('=')
+		})
+		f.appendValue(buf, field, false)
+	}
+
+	f.appendCaller(buf, e)
+	buf.AppendByte('\n')
+
+	if traces {
+		for _, field := range fields {
+			if isTrace(field) {
+				f.appendTraceField(buf, field)
+			}
+		}
+	}
+}
+
+// appendTraceField appends a stack trace or an error object as an indented
+// block with lines aligned under the first one.
+func (f *formatter) appendTraceField(buf *logf.Buffer, field Field) {
+	buf.AppendString(expandIndent)
+	f.appendKey(buf, field.Key)
+	f.theme.Separator.at(buf, func() {
+		buf.AppendByte(':')
+	})
+	buf.AppendByte(' ')
+
+	start := buf.Len()
+	f.appendTrace(buf, field.Value)
+	f.indentLines(buf, start, len(expandIndent)+utf8.RuneCount(field.Key)+2)
+	buf.AppendByte('\n')
+}
+
+// appendHeader appends time, level, logger name and message of the entry.
+func (f *formatter) appendHeader(buf *logf.Buffer, e *Entry) {
+	th := f.theme
+
+	// Source.
+	if len(e.Source) != 0 {
+		f.appendSource(buf, e.Source)
+		buf.AppendByte(' ')
+	}
+
 	// Time.
-	appendTime(buf, eseq, e.Time, timeFormat)
+	f.appendTime(buf, e.Time)
 
 	// Level.
 	buf.AppendByte(' ')
-	appendLevel(buf, eseq, e.Level)
+	f.appendLevel(buf, e.Severity)
 
 	// Logger name.
-	if len(e.Name) != 0 {
+	if len(e.Name) > 1 {
 		buf.AppendByte(' ')
-		eseq.At(buf, logftext.EscBrightBlack, func() {
+		th.Logger.at(buf, func() {
 			buf.AppendBytes(e.Name[1 : len(e.Name)-1])
 			buf.AppendByte(':')
 		})
@@ -26,38 +275,115 @@ func format(buf *logf.Buffer, eseq logftext.EscapeSequence, e *Entry, timeFormat
 
 	// Message.
 	buf.AppendByte(' ')
-	eseq.At(buf, logftext.EscBrightWhite, func() {
-		unescapeString(buf, e.Msg[1:len(e.Msg)-1])
+	if len(e.Msg) > 1 {
+		th.Message.at(buf, func() {
+			f.appendText(buf, e.Msg[1:len(e.Msg)-1], f.highlightMsg, th.Message)
+		})
+	}
+}
+
+// appendSource appends the source label padded to the source width.
+func (f *formatter) appendSource(buf *logf.Buffer, source []byte) {
+	f.sourceStyle(source).at(buf, func() {
+		buf.AppendBytes(source)
 	})
+	for n := utf8.RuneCount(source); n < f.sourceWidth; n++ {
+		buf.AppendByte(' ')
+	}
+}
 
-	// Fields.
-	for _, f := range e.Fields {
-		if len(f.Key) == 0 {
-			break
-		}
+// sourceStyle returns a style of the source label selected by its value,
+// so lines of the same source have the same color.
+func (f *formatter) sourceStyle(source []byte) style {
+	n := len(f.theme.Sources)
+	if n == 0 {
+		return ""
+	}
 
-		buf.AppendByte(' ')
-		eseq.At(buf, logftext.EscGreen, func() {
-			key := strings.ToLower(string(f.Key))
-			key = strings.Replace(key, "_", "-", -1)
-			buf.AppendString(key)
-		})
-		eseq.At(buf, logftext.EscBrightBlack, func() {
-			buf.AppendByte('=')
-		})
-		unescapeString(buf, f.Value)
+	// FNV-1a hash.
+	h := uint32(2166136261)
+	for _, c := range source {
+		h ^= uint32(c)
+		h *= 16777619
 	}
 
-	// Caller.
+	return f.theme.Sources[h%uint32(n)]
+}
+
+func (f *formatter) appendKey(buf *logf.Buffer, key []byte) {
+	f.theme.Key.at(buf, func() {
+		key := strings.ToLower(string(key))
+		key = strings.Replace(key, "_", "-", -1)
+		buf.AppendString(key)
+	})
+}
+
+// appendValue appends the value of the field. If unquote is true, string
+// values are printed without quotes.
+func (f *formatter) appendValue(buf *logf.Buffer, field Field, unquote bool) {
+	highlight := f.highlightFields && (f.highlightKey == "" || f.highlightKey == bytesToString(field.Key))
+	val := field.Value
+
+	// Error messages are emphasized.
+	st := f.theme.Value
+	if len(val) != 0 && val[0] == '"' && matchKey(errorKeys, field.Key) {
+		st = f.theme.Error
+	}
+
+	st.at(buf, func() {
+		switch {
+		case unquote && len(val) >= 2 && val[0] == '"':
+			f.appendText(buf, val[1:len(val)-1], highlight, st)
+		case f.flattenDepth != 0:
+			f.appendNestedValue(buf, val, highlight)
+		default:
+			f.appendText(buf, val, highlight, st)
+		}
+	})
+}
+
+func (f *formatter) appendCaller(buf *logf.Buffer, e *Entry) {
 	if len(e.Caller) != 0 {
 		buf.AppendByte(' ')
-		eseq.At(buf, logftext.EscBrightBlack, func() {
+		f.theme.Caller.at(buf, func() {
 			buf.AppendByte('@')
 			buf.AppendBytes(e.Caller)
 		})
 	}
+}
 
-	buf.AppendByte('\n')
+// appendText appends the unescaped text to the buffer. If highlight is
+// true, all matches of the highlight pattern are marked. The st is the
+// style the text is surrounded with, it's restored after each match.
+func (f *formatter) appendText(buf *logf.Buffer, data []byte, highlight bool, st style) {
+	start := buf.Len()
+	unescapeString(buf, data)
+	if !highlight || f.highlight == nil {
+		return
+	}
+
+	locs := f.highlight.FindAllIndex(buf.Data[start:], -1)
+	if len(locs) == 0 {
+		return
+	}
+
+	f.scratch = append(f.scratch[:0], buf.Data[start:]...)
+	buf.Data = buf.Data[:start]
+
+	p := 0
+	for _, loc := range locs {
+		if loc[0] == loc[1] {
+			continue
+		}
+
+		buf.AppendBytes(f.scratch[p:loc[0]])
+		f.theme.Highlight.at(buf, func() {
+			buf.AppendBytes(f.scratch[loc[0]:loc[1]])
+		})
+		buf.AppendString(string(st))
+		p = loc[1]
+	}
+	buf.AppendBytes(f.scratch[p:])
 }
 
 const (
@@ -90,50 +416,39 @@ func formatTemplateBadTime(timeFormat string) {
 	}
 }
 
-func appendTime(buf *logf.Buffer, eseq logftext.EscapeSequence, ts []byte, timeFormat string) {
-	eseq.At(buf, logftext.EscBrightBlack, func() {
+func (f *formatter) appendTime(buf *logf.Buffer, ts []byte) {
+	f.theme.Time.at(buf, func() {
 		t, ok := encodeTime(ts)
 		if !ok {
 			if templateBadTime == "" {
-				formatTemplateBadTime(timeFormat)
+				formatTemplateBadTime(f.timeFormat)
 			}
 			buf.AppendString(templateBadTime)
 
 			return
 		}
-		buf.Data = t.AppendFormat(buf.Data, timeFormat)
+		buf.Data = t.AppendFormat(buf.Data, f.timeFormat)
 	})
 }
 
-func appendLevel(buf *logf.Buffer, eseq logftext.EscapeSequence, lvl []byte) {
-	if len(lvl) < 2 {
-		lvl = []byte(`"unknown"`)
-	}
+// Abbreviations of levels.
+var levelLabels = [...]string{
+	SeverityUnknown:  "UNKN",
+	SeverityTrace:    "TRAC",
+	SeverityDebug:    "DEBU",
+	SeverityInfo:     "INFO",
+	SeverityNotice:   "NOTI",
+	SeverityWarn:     "WARN",
+	SeverityError:    "ERRO",
+	SeverityCritical: "CRIT",
+	SeverityFatal:    "FATA",
+	SeverityPanic:    "PANI",
+}
 
+func (f *formatter) appendLevel(buf *logf.Buffer, s Severity) {
 	buf.AppendByte('|')
-
-	switch strings.ToLower(string(lvl[1 : len(lvl)-1])) {
-	case "debug":
-		eseq.At(buf, logftext.EscMagenta, func() {
-			buf.AppendString("DEBU")
-		})
-	case "info", "information":
-		eseq.At(buf, logftext.EscCyan, func() {
-			buf.AppendString("INFO")
-		})
-	case "warn", "warning":
-		eseq.At2(buf, logftext.EscBrightYellow, logftext.EscReverse, func() {
-			buf.AppendString("WARN")
-		})
-	case "err", "error", "fatal", "panic":
-		eseq.At2(buf, logftext.EscBrightRed, logftext.EscReverse, func() {
-			buf.AppendString("ERRO")
-		})
-	default:
-		eseq.At(buf, logftext.EscBrightRed, func() {
-			buf.AppendString("UNKN")
-		})
-	}
-
+	f.theme.Levels[s].at(buf, func() {
+		buf.AppendString(levelLabels[s])
+	})
 	buf.AppendByte('|')
 }
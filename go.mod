@@ -1,15 +1,21 @@
 module github.com/ssgreg/hlogf
 
+go 1.22
+
 // go: no requirements found in vendor/vendor.json
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
+	github.com/klauspost/compress v1.18.0
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/spf13/cobra v0.0.3
-	github.com/spf13/pflag v1.0.3 // indirect
+	github.com/spf13/pflag v1.0.3
 	github.com/ssgreg/logf v1.0.0
 	github.com/ssgreg/logftext v1.0.0
 	github.com/stretchr/testify v1.2.2 // indirect
+	github.com/ulikunitz/xz v0.5.15
 	golang.org/x/sys v0.0.0-20181213081344-73d4af5aa059 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
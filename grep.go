@@ -0,0 +1,70 @@
+package main
+
+import (
+	"regexp"
+)
+
+// grepFilter matches entries with the message or any field value matching
+// the pattern. Values are matched after unescaping, keys are not matched.
+type grepFilter struct {
+	re *regexp.Regexp
+
+	// If key is not empty, only the value of the field with the given
+	// key (or the value the path points to) is matched. For nested paths
+	// it's the full path, so only a flattened field with this key is
+	// highlighted, not the whole object.
+	key  string
+	path queryPath
+}
+
+// newGrepFilter compiles a grep filter. The pattern is a regular
+// expression unless fixed is true.
+func newGrepFilter(pattern string, fixed, ignoreCase bool, key string) (*grepFilter, error) {
+	if fixed {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &grepFilter{re: re}
+	if key != "" {
+		f.path, err = parseQueryPath(key)
+		if err != nil {
+			return nil, err
+		}
+		f.key = f.path.full
+	}
+
+	return f, nil
+}
+
+func (f *grepFilter) Match(e *Entry) bool {
+	if f.key != "" {
+		v, ok := f.path.lookup(e)
+
+		return ok && f.re.Match(textValue(v))
+	}
+
+	if f.re.Match(textValue(e.Msg)) {
+		return true
+	}
+	for _, field := range e.Fields {
+		if f.re.Match(textValue(field.Value)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchRaw implements rawFilter. Lines that are not parsed are matched as
+// is, unless the search is limited to a field.
+func (f *grepFilter) MatchRaw(data []byte) bool {
+	return f.key == "" && f.re.Match(data)
+}
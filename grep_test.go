@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ssgreg/logf"
+)
+
+func TestGrepHighlightNested(t *testing.T) {
+	grep, err := newGrepFilter("abc", true, false, "http.path")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var e Entry
+	if !parse([]byte(`{"msg":"abc","http":{"method":"abc","path":"/abc"}}`), defaultFieldMapping, &e) {
+		t.Fatal("failed to parse entry")
+	}
+	if !grep.Match(&e) {
+		t.Fatal("expected to match")
+	}
+
+	const mark = "[H]"
+	cases := []struct {
+		flattenDepth int
+		highlighted  string
+	}{
+		// The object is not highlighted as a whole.
+		{0, ""},
+		// Only the value the path points to is highlighted.
+		{1, `http.path="/` + mark + "abc"},
+	}
+
+	for _, c := range cases {
+		f := newFormatter(Options{Grep: grep, FlattenDepth: c.flattenDepth, Theme: &theme{Highlight: mark}})
+		buf := logf.NewBuffer()
+		f.format(buf, &e)
+
+		r := buf.String()
+		if n := strings.Count(r, mark); n != strings.Count(c.highlighted, mark) {
+			t.Errorf("%d: unexpected highlighting in %q", c.flattenDepth, r)
+		}
+		if !strings.Contains(r, c.highlighted) {
+			t.Errorf("%d: expected %q in %q", c.flattenDepth, c.highlighted, r)
+		}
+	}
+}
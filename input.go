@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// input is an opened input: a file or stdin. Compressed files are
+// decompressed and journal files are read as JSON lines. Read errors are
+// prefixed with the name of the input.
+type input struct {
+	name    string
+	r       io.Reader
+	journal bool
+	close   []func()
+}
+
+// openInput opens the named file or stdin if the name is "-".
+func openInput(name string) (*input, error) {
+	in := &input{name: name}
+	var f *os.File
+	if name == "-" {
+		in.name = "stdin"
+		f = os.Stdin
+	} else {
+		var err error
+		f, err = os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		in.close = append(in.close, func() {
+			_ = f.Close()
+		})
+	}
+
+	if isJournalFile(name) {
+		r, err := newJournalReader(f)
+		if err != nil {
+			in.Close()
+
+			return nil, fmt.Errorf("%s: %s", in.name, err)
+		}
+		in.r = r
+		in.journal = true
+		in.close = append(in.close, r.Close)
+
+		return in, nil
+	}
+
+	d, err := decompress(f)
+	if err != nil {
+		in.Close()
+
+		return nil, fmt.Errorf("%s: %s", in.name, err)
+	}
+	in.r = d
+	in.close = append(in.close, func() {
+		_ = d.Close()
+	})
+
+	return in, nil
+}
+
+// Read implements io.Reader.
+func (in *input) Read(p []byte) (int, error) {
+	n, err := in.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%s: %s", in.name, err)
+	}
+
+	return n, err
+}
+
+// Close closes the input in the reverse order of opening.
+func (in *input) Close() {
+	for i := len(in.close) - 1; i >= 0; i-- {
+		in.close[i]()
+	}
+}
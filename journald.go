@@ -0,0 +1,57 @@
+package main
+
+// In journald mode entries of systemd journal, e.g. from
+// "journalctl -o json", are shown with SYSLOG_IDENTIFIER or _SYSTEMD_UNIT
+// as the logger name. Trusted fields starting with '_' and syslog fields
+// are hidden unless included, other fields are shown unless excluded:
+//
+// 	hlogf --journald --journal-include _PID,_HOSTNAME --journal-exclude 'CODE_*'
+
+// Keys of journal entries used as the logger name in order of priority.
+var journalLoggerKeys = []string{"SYSLOG_IDENTIFIER", "_SYSTEMD_UNIT"}
+
+// journalFields selects fields of journal entries to show. Lists contain
+// glob patterns.
+type journalFields struct {
+	include []string
+	exclude []string
+}
+
+// show checks whether the field with the given key should be shown.
+func (j *journalFields) show(key []byte) bool {
+	k := bytesToString(key)
+	if matchAny(j.exclude, k) {
+		return false
+	}
+
+	return matchAny(j.include, k) || !hiddenJournalField(key)
+}
+
+// hiddenJournalField checks whether the field is hidden by default.
+func hiddenJournalField(key []byte) bool {
+	if len(key) == 0 || key[0] == '_' {
+		return true
+	}
+
+	switch string(key) {
+	case "SYSLOG_FACILITY", "SYSLOG_IDENTIFIER":
+		return true
+	}
+
+	return false
+}
+
+// withJournal returns a copy of the mapping in journald mode.
+func (m *fieldMapping) withJournal(j *journalFields) *fieldMapping {
+	c := &fieldMapping{keys: make(map[string]mappedRole, len(m.keys)+len(journalLoggerKeys)), journal: j}
+	for key, mr := range m.keys {
+		c.keys[key] = mr
+	}
+	for _, key := range journalLoggerKeys {
+		if _, ok := c.keys[key]; !ok {
+			c.keys[key] = mappedRole{roleLogger, len(c.keys)}
+		}
+	}
+
+	return c
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJournald(t *testing.T) {
+	data := []byte(`{"__REALTIME_TIMESTAMP":"1700000001000000","_SOURCE_REALTIME_TIMESTAMP":"1700000000000000","PRIORITY":4,"_SYSTEMD_UNIT":"ssh.service","SYSLOG_IDENTIFIER":"sshd","_PID":"42","_BOOT_ID":"b","MESSAGE":"hello","CODE_FILE":"x.c","CODE_LINE":"1","SYSLOG_FACILITY":"3"}`)
+
+	cases := []struct {
+		mapping  *fieldMapping
+		logger   string
+		expected string
+	}{
+		{defaultFieldMapping, "", "CODE_FILE CODE_LINE"},
+		{defaultFieldMapping.withJournal(&journalFields{}), `"sshd"`, "CODE_FILE CODE_LINE"},
+		{defaultFieldMapping.withJournal(&journalFields{include: []string{"_PID"}, exclude: []string{"CODE_F*"}}), `"sshd"`, "_PID CODE_LINE"},
+	}
+
+	for i, c := range cases {
+		var e Entry
+		if !parse(data, c.mapping, &e) {
+			t.Fatal("failed to parse")
+		}
+		adoptEntry(&e)
+
+		var keys []string
+		for _, f := range e.Fields {
+			keys = append(keys, string(f.Key))
+		}
+		if string(e.Name) != c.logger || strings.Join(keys, " ") != c.expected {
+			t.Errorf("%d: expected %s %s, got %s %s", i, c.logger, c.expected, e.Name, strings.Join(keys, " "))
+		}
+		if e.Severity != SeverityWarn || string(e.Time) != `"1700000000000000"` {
+			t.Errorf("%d: unexpected severity %s or time %s", i, e.Severity, e.Time)
+		}
+	}
+}
+
+func TestJournalTimestamps(t *testing.T) {
+	cases := []struct {
+		data     string
+		expected string
+	}{
+		// The time of the original message is preferred to the time
+		// the entry was received by journald.
+		{`{"__REALTIME_TIMESTAMP":"1700000001000000","_SOURCE_REALTIME_TIMESTAMP":"1700000000000000","MESSAGE":"a"}`, `"1700000000000000"`},
+		{`{"_SOURCE_REALTIME_TIMESTAMP":"1700000000000000","__REALTIME_TIMESTAMP":"1700000001000000","MESSAGE":"a"}`, `"1700000000000000"`},
+		{`{"__REALTIME_TIMESTAMP":"1700000001000000","MESSAGE":"a"}`, `"1700000001000000"`},
+		{`{"time":"2023-01-01T00:00:00Z","__REALTIME_TIMESTAMP":"1700000001000000","MESSAGE":"a"}`, `"2023-01-01T00:00:00Z"`},
+	}
+
+	for i, c := range cases {
+		var e Entry
+		if !parse([]byte(c.data), defaultFieldMapping, &e) {
+			t.Fatalf("%d: failed to parse", i)
+		}
+		adoptEntry(&e)
+		if string(e.Time) != c.expected {
+			t.Errorf("%d: unexpected time %s, expected %s", i, e.Time, c.expected)
+		}
+	}
+}
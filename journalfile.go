@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ssgreg/logf"
+	"github.com/ulikunitz/xz"
+)
+
+// Systemd journal files are read directly, without journalctl. Entries
+// are converted to JSON lines similar to "journalctl -o json" output and
+// go through the usual parsing. See the format description:
+// https://systemd.io/JOURNAL_FILE_FORMAT/
+
+// isJournalFile checks whether the file name is a name of a journal file,
+// including journal files that were not closed properly.
+func isJournalFile(name string) bool {
+	return strings.HasSuffix(name, ".journal") || strings.HasSuffix(name, ".journal~")
+}
+
+var journalSignature = []byte("LPKSHHRH")
+
+// Incompatible flags of journal files.
+const (
+	journalCompressedXZ   = 1 << 0
+	journalCompressedLZ4  = 1 << 1
+	journalKeyedHash      = 1 << 2
+	journalCompressedZSTD = 1 << 3
+	journalCompact        = 1 << 4
+)
+
+// Types of journal objects.
+const (
+	journalObjectData       = 1
+	journalObjectEntry      = 3
+	journalObjectEntryArray = 6
+)
+
+// Flags of journal data objects.
+const (
+	journalObjectCompressedXZ   = 1 << 0
+	journalObjectCompressedLZ4  = 1 << 1
+	journalObjectCompressedZSTD = 1 << 2
+)
+
+const (
+	journalHeaderMinSize    = 208
+	journalObjectHeaderSize = 16
+
+	// Objects larger than this are considered broken.
+	journalMaxObjectSize = 1 << 30
+)
+
+// journalReader reads entries of a journal file as JSON lines.
+type journalReader struct {
+	r       io.ReaderAt
+	compact bool
+
+	// Entries left according to the header.
+	entries uint64
+
+	// Position in the chain of entry arrays.
+	array     []byte
+	arrayNext uint64
+	arrayItem int
+
+	zstd *zstd.Decoder
+
+	// JSON lines that are not read yet.
+	buf logf.Buffer
+	err error
+}
+
+// newJournalReader checks the header of the journal file and creates a
+// reader of its entries.
+func newJournalReader(r io.ReaderAt) (*journalReader, error) {
+	h := make([]byte, journalHeaderMinSize)
+	_, err := r.ReadAt(h, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal header: %s", err)
+	}
+	if !bytes.Equal(h[:8], journalSignature) {
+		return nil, errors.New("not a journal file")
+	}
+
+	flags := binary.LittleEndian.Uint32(h[12:])
+	known := uint32(journalCompressedXZ | journalCompressedLZ4 | journalKeyedHash | journalCompressedZSTD | journalCompact)
+	if flags&^known != 0 {
+		return nil, fmt.Errorf("unsupported journal features %#x", flags&^known)
+	}
+
+	return &journalReader{
+		r:         r,
+		compact:   flags&journalCompact != 0,
+		entries:   binary.LittleEndian.Uint64(h[152:]),
+		arrayNext: binary.LittleEndian.Uint64(h[176:]),
+	}, nil
+}
+
+// Read implements io.Reader.
+func (j *journalReader) Read(p []byte) (int, error) {
+	for len(j.buf.Data) == 0 {
+		if j.err != nil {
+			return 0, j.err
+		}
+
+		offset, ok, err := j.nextEntry()
+		switch {
+		case err != nil:
+			j.err = err
+		case !ok:
+			j.err = io.EOF
+		default:
+			j.err = j.appendEntry(&j.buf, offset)
+		}
+	}
+
+	n := copy(p, j.buf.Data)
+	j.buf.Data = j.buf.Data[:copy(j.buf.Data, j.buf.Data[n:])]
+
+	return n, nil
+}
+
+// nextEntry returns the offset of the next entry object following the
+// chain of entry arrays.
+func (j *journalReader) nextEntry() (uint64, bool, error) {
+	itemSize := 8
+	if j.compact {
+		itemSize = 4
+	}
+
+	for j.entries != 0 {
+		if j.array != nil && 24+(j.arrayItem+1)*itemSize <= len(j.array) {
+			item := j.array[24+j.arrayItem*itemSize:]
+			j.arrayItem++
+
+			var offset uint64
+			if j.compact {
+				offset = uint64(binary.LittleEndian.Uint32(item))
+			} else {
+				offset = binary.LittleEndian.Uint64(item)
+			}
+			if offset == 0 {
+				// The rest of the array is not used.
+				j.array = nil
+
+				continue
+			}
+			j.entries--
+
+			return offset, true, nil
+		}
+
+		if j.arrayNext == 0 {
+			break
+		}
+		array, err := j.readObject(j.arrayNext, journalObjectEntryArray)
+		if err != nil {
+			return 0, false, err
+		}
+		j.array = array
+		j.arrayItem = 0
+		j.arrayNext = binary.LittleEndian.Uint64(array[16:])
+	}
+
+	return 0, false, nil
+}
+
+// appendEntry appends the entry as a JSON line with its fields and
+// __REALTIME_TIMESTAMP, __MONOTONIC_TIMESTAMP and _BOOT_ID.
+func (j *journalReader) appendEntry(buf *logf.Buffer, offset uint64) error {
+	entry, err := j.readObject(offset, journalObjectEntry)
+	if err != nil {
+		return err
+	}
+	if len(entry) < 64 {
+		return fmt.Errorf("journal entry at %d is too small", offset)
+	}
+
+	buf.AppendString(`{"__REALTIME_TIMESTAMP":"`)
+	buf.Data = strconv.AppendUint(buf.Data, binary.LittleEndian.Uint64(entry[24:]), 10)
+	buf.AppendString(`","__MONOTONIC_TIMESTAMP":"`)
+	buf.Data = strconv.AppendUint(buf.Data, binary.LittleEndian.Uint64(entry[32:]), 10)
+	buf.AppendString(`","_BOOT_ID":"`)
+	buf.AppendString(hex.EncodeToString(entry[40:56]))
+	buf.AppendByte('"')
+
+	itemSize := 16
+	if j.compact {
+		itemSize = 4
+	}
+	for item := entry[64:]; len(item) >= itemSize; item = item[itemSize:] {
+		var data uint64
+		if j.compact {
+			data = uint64(binary.LittleEndian.Uint32(item))
+		} else {
+			data = binary.LittleEndian.Uint64(item)
+		}
+
+		payload, err := j.readData(data)
+		if err != nil {
+			return err
+		}
+		i := bytes.IndexByte(payload, '=')
+		if i <= 0 {
+			continue
+		}
+
+		buf.AppendByte(',')
+		appendJSONString(buf, payload[:i])
+		buf.AppendByte(':')
+		appendJSONString(buf, payload[i+1:])
+	}
+
+	buf.AppendString("}\n")
+
+	return nil
+}
+
+// readData returns the decompressed payload of the data object.
+func (j *journalReader) readData(offset uint64) ([]byte, error) {
+	data, err := j.readObject(offset, journalObjectData)
+	if err != nil {
+		return nil, err
+	}
+
+	start := 64
+	if j.compact {
+		start = 72
+	}
+	if len(data) < start {
+		return nil, fmt.Errorf("journal data at %d is too small", offset)
+	}
+	payload := data[start:]
+
+	switch flags := data[1]; {
+	case flags&journalObjectCompressedXZ != 0:
+		r, err := xz.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("journal data at %d: %s", offset, err)
+		}
+		payload, err = ioutil.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("journal data at %d: %s", offset, err)
+		}
+
+	case flags&journalObjectCompressedLZ4 != 0:
+		if len(payload) < 8 {
+			return nil, fmt.Errorf("journal data at %d: bad lz4 payload", offset)
+		}
+		payload, err = decodeLZ4Block(payload[8:], binary.LittleEndian.Uint64(payload))
+		if err != nil {
+			return nil, fmt.Errorf("journal data at %d: %s", offset, err)
+		}
+
+	case flags&journalObjectCompressedZSTD != 0:
+		if j.zstd == nil {
+			j.zstd, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+		}
+		payload, err = j.zstd.DecodeAll(payload, nil)
+		if err != nil {
+			return nil, fmt.Errorf("journal data at %d: %s", offset, err)
+		}
+	}
+
+	return payload, nil
+}
+
+// readObject reads the object of the given type at the given offset.
+func (j *journalReader) readObject(offset uint64, typ byte) ([]byte, error) {
+	h := make([]byte, journalObjectHeaderSize)
+	_, err := j.r.ReadAt(h, int64(offset))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal object at %d: %s", offset, err)
+	}
+	if h[0] != typ {
+		return nil, fmt.Errorf("journal object at %d has type %d, expected %d", offset, h[0], typ)
+	}
+	size := binary.LittleEndian.Uint64(h[8:])
+	if size < journalObjectHeaderSize || size > journalMaxObjectSize {
+		return nil, fmt.Errorf("journal object at %d has bad size %d", offset, size)
+	}
+
+	obj := make([]byte, size)
+	_, err = j.r.ReadAt(obj, int64(offset))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal object at %d: %s", offset, err)
+	}
+
+	return obj, nil
+}
+
+// Close releases resources of the reader.
+func (j *journalReader) Close() {
+	if j.zstd != nil {
+		j.zstd.Close()
+	}
+}
+
+// decodeLZ4Block decodes a LZ4 block of the given decompressed size.
+func decodeLZ4Block(src []byte, size uint64) ([]byte, error) {
+	if size > journalMaxObjectSize {
+		return nil, errors.New("lz4: bad size")
+	}
+	dst := make([]byte, 0, size)
+
+	// readLength reads an extended length of literals or match.
+	readLength := func(i int, n int) (int, int, bool) {
+		if n != 15 {
+			return i, n, true
+		}
+		for i < len(src) {
+			b := src[i]
+			i++
+			n += int(b)
+			if b != 255 {
+				return i, n, true
+			}
+		}
+
+		return i, n, false
+	}
+
+	for i := 0; i < len(src); {
+		token := src[i]
+		i++
+
+		// Literals.
+		var n int
+		var ok bool
+		i, n, ok = readLength(i, int(token>>4))
+		if !ok || i+n > len(src) {
+			return nil, errors.New("lz4: bad literals")
+		}
+		dst = append(dst, src[i:i+n]...)
+		i += n
+		if i == len(src) {
+			// The last sequence has no match.
+			break
+		}
+
+		// Match.
+		if i+2 > len(src) {
+			return nil, errors.New("lz4: bad match offset")
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+		if offset == 0 || offset > len(dst) {
+			return nil, errors.New("lz4: bad match offset")
+		}
+		i, n, ok = readLength(i, int(token&15))
+		if !ok {
+			return nil, errors.New("lz4: bad match length")
+		}
+		n += 4
+		if uint64(len(dst)+n) > size {
+			return nil, errors.New("lz4: data is longer than expected")
+		}
+
+		// Matches may overlap with the copied data.
+		start := len(dst) - offset
+		for k := 0; k < n; k++ {
+			dst = append(dst, dst[start+k])
+		}
+	}
+
+	if uint64(len(dst)) != size {
+		return nil, errors.New("lz4: data is shorter than expected")
+	}
+
+	return dst, nil
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+var updateJournals = flag.Bool("update-journals", false, "regenerate journal files in testdata")
+
+// Journal files in testdata are built by journalBuilder. Both contain the
+// same entries, listed in two chained entry arrays, the last one with
+// unused items. The message of the third entry is compressed.
+var testJournals = []struct {
+	name        string
+	compact     bool
+	compression byte
+}{
+	{"regular-xz.journal", false, journalObjectCompressedXZ},
+	{"compact-zstd.journal", true, journalObjectCompressedZSTD},
+}
+
+var testJournalLines = []string{
+	`{"__REALTIME_TIMESTAMP":"1704103200000001","__MONOTONIC_TIMESTAMP":"1001","_BOOT_ID":"0102030405060708090a0b0c0d0e0f10","MESSAGE":"first","PRIORITY":"6","_SYSTEMD_UNIT":"app.service"}`,
+	`{"__REALTIME_TIMESTAMP":"1704103200000002","__MONOTONIC_TIMESTAMP":"1002","_BOOT_ID":"0102030405060708090a0b0c0d0e0f10","MESSAGE":"second \"quoted\"\n","PRIORITY":"3","_SYSTEMD_UNIT":"app.service"}`,
+	`{"__REALTIME_TIMESTAMP":"1704103200000003","__MONOTONIC_TIMESTAMP":"1003","_BOOT_ID":"0102030405060708090a0b0c0d0e0f10","MESSAGE":"third ` + strings.Repeat("x", 100) + `","PRIORITY":"4"}`,
+}
+
+// journalBuilder builds a minimal journal file with data, entry and entry
+// array objects. Hash tables are not built as the reader doesn't use them.
+type journalBuilder struct {
+	compact bool
+	data    []byte
+}
+
+const testJournalHeaderSize = 272
+
+func newJournalBuilder(compact bool) *journalBuilder {
+	return &journalBuilder{compact: compact, data: make([]byte, testJournalHeaderSize)}
+}
+
+// object appends an object and returns its offset.
+func (b *journalBuilder) object(typ, flags byte, body []byte) uint64 {
+	for len(b.data)%8 != 0 {
+		b.data = append(b.data, 0)
+	}
+	offset := uint64(len(b.data))
+
+	h := make([]byte, journalObjectHeaderSize)
+	h[0], h[1] = typ, flags
+	binary.LittleEndian.PutUint64(h[8:], uint64(len(h)+len(body)))
+	b.data = append(append(b.data, h...), body...)
+
+	return offset
+}
+
+// offset appends an offset of the size used by the file.
+func (b *journalBuilder) offset(dst []byte, offset uint64) []byte {
+	if b.compact {
+		return binary.LittleEndian.AppendUint32(dst, uint32(offset))
+	}
+
+	return binary.LittleEndian.AppendUint64(dst, offset)
+}
+
+func (b *journalBuilder) dataObject(t *testing.T, payload string, compression byte) uint64 {
+	body := make([]byte, 48)
+	if b.compact {
+		body = append(body, make([]byte, 8)...)
+	}
+
+	switch compression {
+	case journalObjectCompressedXZ:
+		var buf bytes.Buffer
+		w, err := xz.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(payload))
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		body = append(body, buf.Bytes()...)
+	case journalObjectCompressedZSTD:
+		e, err := zstd.NewWriter(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body = e.EncodeAll([]byte(payload), body)
+	default:
+		body = append(body, payload...)
+	}
+
+	return b.object(journalObjectData, compression, body)
+}
+
+func (b *journalBuilder) entry(n uint64, data ...uint64) uint64 {
+	body := make([]byte, 48)
+	binary.LittleEndian.PutUint64(body, n)
+	binary.LittleEndian.PutUint64(body[8:], 1704103200000000+n)
+	binary.LittleEndian.PutUint64(body[16:], 1000+n)
+	for i := 0; i < 16; i++ {
+		body[24+i] = byte(i + 1)
+	}
+	for _, offset := range data {
+		body = b.offset(body, offset)
+		if !b.compact {
+			// Hash of the data object.
+			body = append(body, make([]byte, 8)...)
+		}
+	}
+
+	return b.object(journalObjectEntry, 0, body)
+}
+
+func (b *journalBuilder) entryArray(next uint64, items ...uint64) uint64 {
+	body := binary.LittleEndian.AppendUint64(nil, next)
+	for _, offset := range items {
+		body = b.offset(body, offset)
+	}
+
+	return b.object(journalObjectEntryArray, 0, body)
+}
+
+// header fills the header of the file.
+func (b *journalBuilder) header(flags uint32, entries, entryArray uint64) []byte {
+	h := b.data[:testJournalHeaderSize]
+	copy(h, journalSignature)
+	binary.LittleEndian.PutUint32(h[12:], flags)
+	binary.LittleEndian.PutUint64(h[88:], testJournalHeaderSize)
+	binary.LittleEndian.PutUint64(h[96:], uint64(len(b.data)-testJournalHeaderSize))
+	binary.LittleEndian.PutUint64(h[152:], entries)
+	binary.LittleEndian.PutUint64(h[176:], entryArray)
+
+	return b.data
+}
+
+func buildTestJournal(t *testing.T, compact bool, compression byte) []byte {
+	b := newJournalBuilder(compact)
+
+	unit := b.dataObject(t, "_SYSTEMD_UNIT=app.service", 0)
+	e1 := b.entry(1,
+		b.dataObject(t, "MESSAGE=first", 0),
+		b.dataObject(t, "PRIORITY=6", 0),
+		unit)
+	e2 := b.entry(2,
+		b.dataObject(t, "MESSAGE=second \"quoted\"\n", 0),
+		b.dataObject(t, "PRIORITY=3", 0),
+		unit)
+	e3 := b.entry(3,
+		b.dataObject(t, "MESSAGE=third "+strings.Repeat("x", 100), compression),
+		b.dataObject(t, "NOT A FIELD", 0),
+		b.dataObject(t, "PRIORITY=4", 0))
+
+	last := b.entryArray(0, e3, 0, 0, 0)
+	first := b.entryArray(last, e1, e2)
+
+	flags := uint32(journalCompressedXZ)
+	if compression == journalObjectCompressedZSTD {
+		flags = journalCompressedZSTD
+	}
+	if compact {
+		flags |= journalCompact
+	}
+
+	return b.header(flags, 3, first)
+}
+
+func TestJournalReader(t *testing.T) {
+	for _, c := range testJournals {
+		path := filepath.Join("testdata", c.name)
+		if *updateJournals {
+			err := ioutil.WriteFile(path, buildTestJournal(t, c.compact, c.compression), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		in, err := openInput(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := ioutil.ReadAll(in)
+		in.Close()
+		if err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+		if !in.journal {
+			t.Errorf("%s: not read as a journal", c.name)
+		}
+
+		expected := strings.Join(testJournalLines, "\n") + "\n"
+		if string(r) != expected {
+			t.Errorf("%s: unexpected lines:\n%s\nexpected:\n%s", c.name, r, expected)
+		}
+	}
+}
+
+func TestJournalReaderEntries(t *testing.T) {
+	data := buildTestJournal(t, false, 0)
+
+	// The number of entries in the header limits the number of read
+	// entries.
+	binary.LittleEndian.PutUint64(data[152:], 2)
+	j, err := newJournalReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := ioutil.ReadAll(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(r), "\n"); n != 2 {
+		t.Errorf("expected 2 entries, got %d", n)
+	}
+}
+
+func TestJournalReaderErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(data []byte) []byte
+		err    string
+	}{
+		{"short", func(data []byte) []byte {
+			return data[:100]
+		}, "failed to read journal header"},
+		{"signature", func(data []byte) []byte {
+			copy(data, "LPKSHHRX")
+			return data
+		}, "not a journal file"},
+		{"features", func(data []byte) []byte {
+			binary.LittleEndian.PutUint32(data[12:], 1<<10|journalCompressedXZ)
+			return data
+		}, "unsupported journal features 0x400"},
+		{"object type", func(data []byte) []byte {
+			// The entry array offset points to the first data object.
+			binary.LittleEndian.PutUint64(data[176:], testJournalHeaderSize)
+			return data
+		}, "has type 1, expected 6"},
+		{"object size", func(data []byte) []byte {
+			binary.LittleEndian.PutUint64(data[testJournalHeaderSize+8:], 8)
+			return data
+		}, "has bad size 8"},
+		{"truncated", func(data []byte) []byte {
+			return data[:len(data)-8]
+		}, "failed to read journal object"},
+	}
+
+	for _, c := range cases {
+		data := c.modify(buildTestJournal(t, false, 0))
+
+		j, err := newJournalReader(bytes.NewReader(data))
+		if err == nil {
+			_, err = ioutil.ReadAll(j)
+		}
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: unexpected error %v, expected %q", c.name, err, c.err)
+		}
+	}
+}
+
+func TestDecodeLZ4Block(t *testing.T) {
+	// "abc" literals, a match of 9 bytes at offset 3, "hello" literals.
+	src := []byte("\x35abc\x03\x00\x50hello")
+
+	r, err := decodeLZ4Block(src, 17)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(r) != "abcabcabcabchello" {
+		t.Errorf("unexpected result: %q", r)
+	}
+
+	_, err = decodeLZ4Block(src, 16)
+	if err == nil {
+		t.Error("expected error for wrong size")
+	}
+	_, err = decodeLZ4Block([]byte("\x35abc\x04\x00"), 12)
+	if err == nil {
+		t.Error("expected error for bad offset")
+	}
+}
+
+func TestIsJournalFile(t *testing.T) {
+	cases := map[string]bool{
+		"system.journal":             true,
+		"user-1000@0005-01.journal~": true,
+		"app.log":                    false,
+		"journal":                    false,
+	}
+	for name, expected := range cases {
+		if isJournalFile(name) != expected {
+			t.Errorf("unexpected result for %q", name)
+		}
+	}
+}
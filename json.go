@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ssgreg/logf"
+)
+
+// formatJSON formats the entry as a normalized JSON object:
+//
+//	{"time":"2018-12-13T22:21:26.84954039+03:00","level":"debug","logger":"token","msg":"request done","status":200,"caller":"token/resource.go:66"}
+//
+// Time is converted to RFC3339 with nanoseconds, level is converted to
+// its canonical name. Other values are copied verbatim. Fields named the
+// same as the entry's own keys are prefixed with "fields.".
+func (f *formatter) formatJSON(buf *logf.Buffer, e *Entry) {
+	buf.AppendByte('{')
+	first := true
+	appendKey := func(key []byte) {
+		if !first {
+			buf.AppendByte(',')
+		}
+		first = false
+
+		f.appendJSONKey(buf, key)
+		buf.AppendByte(':')
+	}
+
+	// Source.
+	if len(e.Source) != 0 {
+		appendKey([]byte("source"))
+		appendJSONString(buf, e.Source)
+	}
+
+	// Time.
+	if t, ok := encodeTime(e.Time); ok {
+		appendKey([]byte("time"))
+		buf.AppendByte('"')
+		buf.Data = t.AppendFormat(buf.Data, time.RFC3339Nano)
+		buf.AppendByte('"')
+	} else if len(e.Time) != 0 {
+		appendKey([]byte("time"))
+		buf.AppendBytes(e.Time)
+	}
+
+	// Level.
+	if e.Severity != SeverityUnknown {
+		appendKey([]byte("level"))
+		buf.AppendByte('"')
+		buf.AppendString(e.Severity.String())
+		buf.AppendByte('"')
+	} else if len(e.Level) != 0 {
+		appendKey([]byte("level"))
+		buf.AppendBytes(e.Level)
+	}
+
+	// Logger name.
+	if len(e.Name) != 0 {
+		appendKey([]byte("logger"))
+		buf.AppendBytes(e.Name)
+	}
+
+	// Message.
+	if len(e.Msg) != 0 {
+		appendKey([]byte("msg"))
+		buf.AppendBytes(e.Msg)
+	}
+
+	// Fields.
+	for _, field := range f.fieldsOf(e) {
+		appendKey(f.fieldKey(e, field.Key))
+		buf.AppendBytes(field.Value)
+	}
+
+	// Caller.
+	if len(e.Caller) != 0 {
+		appendKey([]byte("caller"))
+		buf.AppendBytes(e.Caller)
+	}
+
+	buf.AppendString("}\n")
+}
+
+// formatRawJSON wraps a line that is not parsed to a JSON object to keep
+// the output valid.
+func formatRawJSON(buf *logf.Buffer, data, source []byte) {
+	buf.AppendByte('{')
+	if len(source) != 0 {
+		buf.AppendString(`"source":`)
+		appendJSONString(buf, source)
+		buf.AppendByte(',')
+	}
+	buf.AppendString(`"msg":`)
+	appendJSONString(buf, data)
+	buf.AppendString("}\n")
+}
+
+// appendJSONKey appends a quoted key. Keys of JSON input are kept escaped,
+// so they are unescaped first not to be escaped twice.
+func (f *formatter) appendJSONKey(buf *logf.Buffer, key []byte) {
+	if bytes.IndexByte(key, '\\') != -1 {
+		start := buf.Len()
+		unescapeString(buf, key)
+		f.scratch = append(f.scratch[:0], buf.Data[start:]...)
+		buf.Data = buf.Data[:start]
+		key = f.scratch
+	}
+
+	appendJSONString(buf, key)
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString appends the data as a quoted JSON string.
+func appendJSONString(buf *logf.Buffer, data []byte) {
+	buf.AppendByte('"')
+
+	p := 0
+	for i := 0; i < len(data); {
+		c := data[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRune(data[i:])
+			if r == utf8.RuneError && size == 1 {
+				buf.AppendBytes(data[p:i])
+				buf.AppendString(`�`)
+				p = i + size
+			}
+			i += size
+
+			continue
+		}
+		if c >= ' ' && c != '"' && c != '\\' {
+			i++
+
+			continue
+		}
+
+		buf.AppendBytes(data[p:i])
+		switch c {
+		case '"', '\\':
+			buf.AppendByte('\\')
+			buf.AppendByte(c)
+		case '\n':
+			buf.AppendString(`\n`)
+		case '\r':
+			buf.AppendString(`\r`)
+		case '\t':
+			buf.AppendString(`\t`)
+		default:
+			buf.AppendString(`\u00`)
+			buf.AppendByte(hexDigits[c>>4])
+			buf.AppendByte(hexDigits[c&0xf])
+		}
+		i++
+		p = i
+	}
+	buf.AppendBytes(data[p:])
+
+	buf.AppendByte('"')
+}
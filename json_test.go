@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ssgreg/logf"
+)
+
+func TestFormatJSON(t *testing.T) {
+	cases := []struct {
+		line     string
+		expected string
+	}{
+		{`{"msg":"done","a":1,"o":{"b":[1,"x"]}}`, `{"msg":"done","a":1,"o":{"b":[1,"x"]}}`},
+		{`{"time":"2024-01-01T10:00:00.5+03:00","level":"warn","msg":"x"}`, `{"time":"2024-01-01T10:00:00.5+03:00","level":"warn","msg":"x"}`},
+
+		// Time that is not parsed is copied as is.
+		{`{"time":"yesterday","msg":"x"}`, `{"time":"yesterday","msg":"x"}`},
+		{`{"time":{"sec":1},"msg":"x"}`, `{"time":{"sec":1},"msg":"x"}`},
+
+		// Keys are escaped.
+		{`{"msg":"x","a\"b":1,"c\\d":2,"e\u0001":3}`, `{"msg":"x","a\"b":1,"c\\d":2,"e\u0001":3}`},
+		{`msg=x a\b=1`, `{"msg":"x","a\\b":1}`},
+
+		// Fields named the same as the entry's own keys are renamed.
+		{`{"ts":"2024-01-01T10:00:00Z","time":"t","msg":"x"}`, `{"time":"2024-01-01T10:00:00Z","msg":"x","fields.time":"t"}`},
+		{`{"msg":"x","caller":"c","logger":"n","source":"s"}`, `{"logger":"n","msg":"x","source":"s","caller":"c"}`},
+	}
+
+	for i, c := range cases {
+		r := formatLine(t, outputJSON, c.line)
+		if r != c.expected+"\n" {
+			t.Errorf("%d: expected %s, got %s", i, c.expected, r)
+		}
+		if !json.Valid([]byte(r)) {
+			t.Errorf("%d: invalid JSON %s", i, r)
+		}
+	}
+}
+
+func TestFormatJSONSource(t *testing.T) {
+	var e Entry
+	if !parse([]byte(`{"msg":"x","source":"s"}`), defaultFieldMapping, &e) {
+		t.Fatal("failed to parse entry")
+	}
+	e.Source = []byte(`pod "1"`)
+
+	f := newFormatter(Options{NoColor: true, Output: outputJSON})
+	buf := logf.NewBuffer()
+	f.format(buf, &e)
+	if r := buf.String(); r != `{"source":"pod \"1\"","msg":"x","fields.source":"s"}`+"\n" {
+		t.Errorf("unexpected output %s", r)
+	}
+}
+
+func TestFormatRawJSON(t *testing.T) {
+	cases := []struct {
+		data     string
+		source   string
+		expected string
+	}{
+		{"plain text", "", `{"msg":"plain text"}`},
+		{`say "hi" \ bye`, "", `{"msg":"say \"hi\" \\ bye"}`},
+		{"a\tb\x01\xff", "", `{"msg":"a\tb\u0001�"}`},
+		{"text", `pod "1"`, `{"source":"pod \"1\"","msg":"text"}`},
+	}
+
+	for i, c := range cases {
+		buf := logf.NewBuffer()
+		formatRawJSON(buf, []byte(c.data), []byte(c.source))
+		if r := buf.String(); r != c.expected+"\n" {
+			t.Errorf("%d: expected %s, got %s", i, c.expected, r)
+		}
+		if !json.Valid(buf.Bytes()) {
+			t.Errorf("%d: invalid JSON %s", i, buf.Bytes())
+		}
+	}
+}
+
+func TestOutputOptions(t *testing.T) {
+	_, _, err := handleOutputOptions(rootOptions{output: "json", numberLines: true})
+	if err == nil {
+		t.Error("expected error for numbered JSON output")
+	}
+	_, _, err = handleOutputOptions(rootOptions{output: "logfmt", numberLines: true})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity represents a level of an entry. Levels are ordered from the
+// least to the most severe one.
+type Severity int8
+
+// Known severities.
+const (
+	SeverityUnknown Severity = iota
+	SeverityTrace
+	SeverityDebug
+	SeverityInfo
+	SeverityNotice
+	SeverityWarn
+	SeverityError
+	SeverityCritical
+	SeverityFatal
+	SeverityPanic
+)
+
+var severityNames = map[string]Severity{
+	"trace":         SeverityTrace,
+	"debug":         SeverityDebug,
+	"dbg":           SeverityDebug,
+	"info":          SeverityInfo,
+	"information":   SeverityInfo,
+	"informational": SeverityInfo,
+	"notice":        SeverityNotice,
+	"warn":          SeverityWarn,
+	"warning":       SeverityWarn,
+	"err":           SeverityError,
+	"error":         SeverityError,
+	"crit":          SeverityCritical,
+	"critical":      SeverityCritical,
+	"alert":         SeverityFatal,
+	"fatal":         SeverityFatal,
+	"emerg":         SeverityPanic,
+	"emergency":     SeverityPanic,
+	"panic":         SeverityPanic,
+}
+
+var severityStrings = [...]string{
+	SeverityUnknown:  "unknown",
+	SeverityTrace:    "trace",
+	SeverityDebug:    "debug",
+	SeverityInfo:     "info",
+	SeverityNotice:   "notice",
+	SeverityWarn:     "warn",
+	SeverityError:    "error",
+	SeverityCritical: "critical",
+	SeverityFatal:    "fatal",
+	SeverityPanic:    "panic",
+}
+
+// String returns a canonical lowercase name of the severity.
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityStrings) {
+		return severityStrings[SeverityUnknown]
+	}
+
+	return severityStrings[s]
+}
+
+// parseSeverity returns a severity of the given JSON level value.
+func parseSeverity(lvl []byte) Severity {
+	if len(lvl) < 3 || lvl[0] != '"' || lvl[len(lvl)-1] != '"' {
+		return SeverityUnknown
+	}
+	lvl = lvl[1 : len(lvl)-1]
+
+	// Lower the level without memory allocation. All known names are
+	// short enough.
+	var lower [16]byte
+	if len(lvl) > len(lower) {
+		return SeverityUnknown
+	}
+	for i, c := range lvl {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		lower[i] = c
+	}
+
+	return severityNames[bytesToString(lower[:len(lvl)])]
+}
+
+// parseSeverityOption parses a severity specified by user.
+func parseSeverityOption(name string) (Severity, error) {
+	s, ok := severityNames[strings.ToLower(name)]
+	if !ok {
+		return SeverityUnknown, fmt.Errorf("unknown level %q, expected one of %s", name, strings.Join(severityStrings[1:], ", "))
+	}
+
+	return s, nil
+}
+
+// levelFilter matches entries with severity in the specified range.
+// Entries with unknown severity always match.
+type levelFilter struct {
+	min Severity
+	max Severity
+}
+
+func (f levelFilter) Match(e *Entry) bool {
+	if e.Severity == SeverityUnknown {
+		return true
+	}
+	if f.min != SeverityUnknown && e.Severity < f.min {
+		return false
+	}
+	if f.max != SeverityUnknown && e.Severity > f.max {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseSeverity(t *testing.T) {
+	cases := []struct {
+		lvl      string
+		expected Severity
+	}{
+		{`"trace"`, SeverityTrace},
+		{`"DEBUG"`, SeverityDebug},
+		{`"Info"`, SeverityInfo},
+		{`"notice"`, SeverityNotice},
+		{`"warning"`, SeverityWarn},
+		{`"err"`, SeverityError},
+		{`"crit"`, SeverityCritical},
+		{`"fatal"`, SeverityFatal},
+		{`"panic"`, SeverityPanic},
+		{`"verbose"`, SeverityUnknown},
+		{`"a-very-long-level-name"`, SeverityUnknown},
+		{`info`, SeverityUnknown},
+		{``, SeverityUnknown},
+	}
+
+	for _, c := range cases {
+		if s := parseSeverity([]byte(c.lvl)); s != c.expected {
+			t.Errorf("parseSeverity(%s): expected %v, got %v", c.lvl, c.expected, s)
+		}
+	}
+}
+
+func TestLevelFilter(t *testing.T) {
+	f := levelFilter{min: SeverityInfo, max: SeverityError}
+
+	for s := SeverityTrace; s <= SeverityPanic; s++ {
+		expected := s >= SeverityInfo && s <= SeverityError
+		if f.Match(&Entry{Severity: s}) != expected {
+			t.Errorf("level %v: expected match to be %v", s, expected)
+		}
+	}
+
+	if !f.Match(&Entry{}) {
+		t.Error("entries with unknown level must always match")
+	}
+}
+
+func TestPriorityToLevel(t *testing.T) {
+	for pr := byte('0'); pr <= '7'; pr++ {
+		if s := parseSeverity(priorityToLevel(pr)); s == SeverityUnknown {
+			t.Errorf("priority %c: got unknown severity", pr)
+		}
+	}
+}
@@ -9,6 +9,9 @@ func fetchValue(data []byte) ([]byte, int, bool) {
 		return nil, 0, false
 	}
 	i += length
+	if i >= len(data) {
+		return nil, 0, false
+	}
 
 	switch data[i] {
 	case '"':
@@ -52,6 +55,9 @@ func fetchKey(data []byte) ([]byte, int, bool) {
 		return nil, 0, false
 	}
 	i += length
+	if i >= len(data) {
+		return nil, 0, false
+	}
 
 	if data[i] != '"' {
 		return nil, 0, false
@@ -139,3 +145,76 @@ func handleNonBasicValue(data []byte, delim byte) (int, bool) {
 
 	return 0, false
 }
+
+// walkObject calls fn for each key-value pair of the given JSON object
+// until fn returns false. Keys are returned without quotes. It returns
+// false if the object is malformed.
+func walkObject(obj []byte, fn func(key, val []byte) bool) bool {
+	if len(obj) < 2 || obj[0] != '{' || obj[len(obj)-1] != '}' {
+		return false
+	}
+	data := obj[1 : len(obj)-1]
+	if isBlank(data) {
+		return true
+	}
+
+	for idx := 0; idx < len(data); {
+		key, length, ok := fetchKey(data[idx:])
+		if !ok {
+			return false
+		}
+		idx += length + 1
+
+		val, length, ok := fetchValue(data[idx:])
+		if !ok {
+			return false
+		}
+		idx += length + 1
+
+		if !fn(key, val) {
+			break
+		}
+	}
+
+	return true
+}
+
+// walkArray calls fn for each value of the given JSON array until fn
+// returns false. It returns false if the array is malformed.
+func walkArray(arr []byte, fn func(val []byte) bool) bool {
+	if len(arr) < 2 || arr[0] != '[' || arr[len(arr)-1] != ']' {
+		return false
+	}
+	data := arr[1 : len(arr)-1]
+
+	if isBlank(data) {
+		return true
+	}
+
+	for idx := 0; idx < len(data); {
+		val, length, ok := fetchValue(data[idx:])
+		if !ok {
+			return false
+		}
+		idx += length + 1
+
+		if !fn(val) {
+			break
+		}
+	}
+
+	return true
+}
+
+// isBlank checks whether the given data consists of spaces only.
+func isBlank(data []byte) bool {
+	for _, c := range data {
+		switch c {
+		case ' ', '\t', '\r', '\n':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/ssgreg/logf"
+)
+
+// formatLogfmt formats the entry as a logfmt line:
+//
+//	time=2018-12-13T22:21:26.849+03:00 level=info logger=token msg="request done" status=200 caller=token/resource.go:66
+//
+// Values are quoted if they contain spaces, quotes, '=' or control
+// characters. Keys are printed as is, except the characters not allowed
+// in logfmt keys that are replaced with '_'. Fields named the same as the
+// entry's own keys are prefixed with "fields.".
+func (f *formatter) formatLogfmt(buf *logf.Buffer, e *Entry) {
+	th := f.theme
+	first := true
+	appendKey := func(key []byte) {
+		if !first {
+			buf.AppendByte(' ')
+		}
+		first = false
+
+		th.Key.at(buf, func() {
+			appendLogfmtKey(buf, key)
+		})
+		th.Separator.at(buf, func() {
+			buf.AppendByte('=')
+		})
+	}
+
+	// Source.
+	if len(e.Source) != 0 {
+		appendKey([]byte("source"))
+		f.sourceStyle(e.Source).at(buf, func() {
+			appendLogfmtValue(buf, e.Source)
+		})
+	}
+
+	// Time.
+	if t, ok := encodeTime(e.Time); ok {
+		appendKey([]byte("time"))
+		th.Time.at(buf, func() {
+			f.scratch = t.AppendFormat(f.scratch[:0], f.timeFormat)
+			appendLogfmtValue(buf, f.scratch)
+		})
+	} else if len(e.Time) != 0 {
+		appendKey([]byte("time"))
+		th.Time.at(buf, func() {
+			f.appendLogfmtJSONValue(buf, e.Time)
+		})
+	}
+
+	// Level.
+	if e.Severity != SeverityUnknown || len(e.Level) != 0 {
+		appendKey([]byte("level"))
+		th.Levels[e.Severity].at(buf, func() {
+			if e.Severity != SeverityUnknown {
+				buf.AppendString(e.Severity.String())
+			} else {
+				f.appendLogfmtJSONValue(buf, e.Level)
+			}
+		})
+	}
+
+	// Logger name.
+	if len(e.Name) != 0 {
+		appendKey([]byte("logger"))
+		th.Logger.at(buf, func() {
+			f.appendLogfmtJSONValue(buf, e.Name)
+		})
+	}
+
+	// Message.
+	if len(e.Msg) != 0 {
+		appendKey([]byte("msg"))
+		th.Message.at(buf, func() {
+			f.appendLogfmtJSONValue(buf, e.Msg)
+		})
+	}
+
+	// Fields.
+	for _, field := range f.fieldsOf(e) {
+		appendKey(f.fieldKey(e, field.Key))
+		th.Value.at(buf, func() {
+			f.appendLogfmtJSONValue(buf, field.Value)
+		})
+	}
+
+	// Caller.
+	if len(e.Caller) != 0 {
+		appendKey([]byte("caller"))
+		th.Caller.at(buf, func() {
+			f.appendLogfmtJSONValue(buf, e.Caller)
+		})
+	}
+
+	buf.AppendByte('\n')
+}
+
+// appendLogfmtJSONValue appends a JSON value as a logfmt value. Strings are
+// unescaped, other values are kept as is.
+func (f *formatter) appendLogfmtJSONValue(buf *logf.Buffer, val []byte) {
+	if len(val) >= 2 && val[0] == '"' {
+		start := buf.Len()
+		unescapeString(buf, val[1:len(val)-1])
+		f.scratch = append(f.scratch[:0], buf.Data[start:]...)
+		buf.Data = buf.Data[:start]
+		val = f.scratch
+	}
+
+	appendLogfmtValue(buf, val)
+}
+
+// appendLogfmtValue appends a value quoting it if necessary.
+func appendLogfmtValue(buf *logf.Buffer, val []byte) {
+	if !logfmtNeedsQuoting(val) {
+		buf.AppendBytes(val)
+
+		return
+	}
+
+	buf.Data = strconv.AppendQuote(buf.Data, bytesToString(val))
+}
+
+func logfmtNeedsQuoting(val []byte) bool {
+	if len(val) == 0 {
+		return true
+	}
+
+	for i := 0; i < len(val); {
+		c := val[i]
+		if c < utf8.RuneSelf {
+			if c <= ' ' || c == '=' || c == '"' || c == '\\' || c == 0x7f {
+				return true
+			}
+			i++
+
+			continue
+		}
+
+		r, size := utf8.DecodeRune(val[i:])
+		if r == utf8.RuneError && size == 1 {
+			return true
+		}
+		i += size
+	}
+
+	return false
+}
+
+// appendLogfmtKey appends a key replacing characters that are not allowed
+// in logfmt keys with '_'. Escape sequences of JSON keys are not expected.
+func appendLogfmtKey(buf *logf.Buffer, key []byte) {
+	if len(key) == 0 {
+		buf.AppendByte('_')
+
+		return
+	}
+
+	for _, c := range key {
+		if c <= ' ' || c == '=' || c == '"' || c == '\\' || c == 0x7f {
+			c = '_'
+		}
+		buf.AppendByte(c)
+	}
+}
+
+// parseLogfmt parses a logfmt line to the given entry:
+//
+//	ts=2018-12-13T22:21:26.849+03:00 level=info msg="request done" status=200
+//
+// Values are converted to JSON form to be handled the same way as values
+// of JSON objects: quoted values are kept as is, unquoted values other
+// than numbers, true, false and null are quoted to the entry's arena. It
+// returns false if the line is not a sequence of key=value pairs or if
+// none of its keys is mapped to a role, e.g. for plain text lines.
+func parseLogfmt(data []byte, m *fieldMapping, t *Entry) bool {
+	var rs roleState
+	roles := false
+
+	for i := 0; ; {
+		for i < len(data) && (data[i] == ' ' || data[i] == '\t') {
+			i++
+		}
+		if i == len(data) {
+			break
+		}
+
+		// Key.
+		start := i
+		for i < len(data) && data[i] > ' ' && data[i] != '=' && data[i] != '"' {
+			i++
+		}
+		if i == start || i == len(data) || data[i] != '=' {
+			return false
+		}
+		key := data[start:i]
+		if bytes.IndexByte(key, '\\') != -1 {
+			// Keys are kept in JSON form the same as keys of JSON objects.
+			key = t.quoteString(key)
+			key = key[1 : len(key)-1]
+		}
+		i++
+
+		// Value.
+		var val []byte
+		if i < len(data) && data[i] == '"' {
+			length, ok := handleString(data[i+1:])
+			if !ok {
+				return false
+			}
+			val = data[i : i+length+2]
+			i += length + 2
+			if i < len(data) && data[i] != ' ' && data[i] != '\t' {
+				return false
+			}
+		} else {
+			start = i
+			for i < len(data) && data[i] != ' ' && data[i] != '\t' {
+				i++
+			}
+			val = t.quote(data[start:i])
+		}
+
+		if _, ok := m.keys[string(key)]; ok {
+			roles = true
+		}
+		t.set(m, &rs, key, val)
+	}
+
+	return roles
+}
+
+// quote returns the value in JSON form. Values other than numbers, true,
+// false and null are quoted to the arena.
+func (t *Entry) quote(val []byte) []byte {
+	switch string(val) {
+	case "true", "false", "null":
+		return val
+	}
+	if isJSONNumber(val) {
+		return val
+	}
+
+	return t.quoteString(val)
+}
+
+// quoteString returns the value quoted to the arena as a JSON string.
+func (t *Entry) quoteString(val []byte) []byte {
+	// Slices of the arena stay valid when it grows, as the data they
+	// point to is never changed until the entry is reset.
+	start := len(t.arena)
+	t.arena = append(t.arena, '"')
+	for _, c := range val {
+		switch {
+		case c == '"' || c == '\\':
+			t.arena = append(t.arena, '\\', c)
+		case c == '\t':
+			t.arena = append(t.arena, '\\', 't')
+		case c < ' ':
+			t.arena = append(t.arena, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+		default:
+			t.arena = append(t.arena, c)
+		}
+	}
+	t.arena = append(t.arena, '"')
+
+	return t.arena[start:len(t.arena):len(t.arena)]
+}
+
+// isJSONNumber checks whether the value is a number in JSON syntax.
+func isJSONNumber(val []byte) bool {
+	i := 0
+	digits := func() bool {
+		start := i
+		for i < len(val) && '0' <= val[i] && val[i] <= '9' {
+			i++
+		}
+
+		return i != start
+	}
+
+	if i < len(val) && val[i] == '-' {
+		i++
+	}
+	if !digits() {
+		return false
+	}
+	if i < len(val) && val[i] == '.' {
+		i++
+		if !digits() {
+			return false
+		}
+	}
+	if i < len(val) && (val[i] == 'e' || val[i] == 'E') {
+		i++
+		if i < len(val) && (val[i] == '+' || val[i] == '-') {
+			i++
+		}
+		if !digits() {
+			return false
+		}
+	}
+
+	return i == len(val)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ssgreg/logf"
+)
+
+// formatLine parses the line and formats it with the given output format.
+func formatLine(t *testing.T, output outputFormat, line string) string {
+	var e Entry
+	if !parse([]byte(line), defaultFieldMapping, &e) {
+		t.Fatalf("failed to parse %s", line)
+	}
+
+	f := newFormatter(Options{NoColor: true, Output: output, TimeFormat: "15:04:05"})
+	buf := logf.NewBuffer()
+	f.format(buf, &e)
+
+	return buf.String()
+}
+
+func TestFormatLogfmt(t *testing.T) {
+	cases := []struct {
+		line     string
+		expected string
+	}{
+		{`{"msg":"done","a":"b"}`, "msg=done a=b\n"},
+		{`{"msg":"request done","path":"/a b"}`, `msg="request done" path="/a b"` + "\n"},
+		{`{"msg":"say \"hi\"","q":"\""}`, `msg="say \"hi\"" q="\""` + "\n"},
+		{`{"msg":"a=b","eq":"="}`, `msg="a=b" eq="="` + "\n"},
+		{`{"msg":"x","empty":"","tab":"a\tb","nl":"a\nb"}`, `msg=x empty="" tab="a\tb" nl="a\nb"` + "\n"},
+		{`{"msg":"x","n":1.5,"b":true,"z":null,"o":{"a":1}}`, `msg=x n=1.5 b=true z=null o="{\"a\":1}"` + "\n"},
+		{`{"msg":"x","ключ":"значение","k":"a\\b"}`, `msg=x ключ=значение k="a\\b"` + "\n"},
+		{`{"msg":"x","a b":1,"a=b":2}`, "msg=x a_b=1 a_b=2\n"},
+		{`{"time":"2024-01-01T10:00:00Z","level":"warn","msg":"x"}`, "time=10:00:00 level=warn msg=x\n"},
+
+		// Fields named the same as the entry's own keys are renamed.
+		{`{"ts":"2024-01-01T10:00:00Z","time":"t","msg":"x","level":"l"}`, "time=10:00:00 level=l msg=x fields.time=t\n"},
+		{`{"msg":"x","logger":"a","caller":"b"}`, "logger=a msg=x caller=b\n"},
+		{`{"msg":"x","source":"s"}`, "msg=x source=s\n"},
+		{`{"time":"not a time","msg":"x"}`, `time="not a time" msg=x` + "\n"},
+	}
+
+	for i, c := range cases {
+		if r := formatLine(t, outputLogfmt, c.line); r != c.expected {
+			t.Errorf("%d: expected %q, got %q", i, c.expected, r)
+		}
+	}
+}
+
+func TestFormatLogfmtSource(t *testing.T) {
+	var e Entry
+	if !parse([]byte(`{"msg":"x","source":"s"}`), defaultFieldMapping, &e) {
+		t.Fatal("failed to parse entry")
+	}
+	e.Source = []byte("pod-1")
+
+	f := newFormatter(Options{NoColor: true, Output: outputLogfmt})
+	buf := logf.NewBuffer()
+	f.format(buf, &e)
+	if r := buf.String(); r != "source=pod-1 msg=x fields.source=s\n" {
+		t.Errorf("unexpected output %q", r)
+	}
+}
@@ -1,14 +1,18 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/ssgreg/logftext"
 )
 
@@ -37,11 +41,50 @@ func main() {
 }
 
 type rootOptions struct {
-	coloredLogs string
-	bufferSize  uint
-	numberLines bool
-	timeFormat  string
-	files       []string
+	coloredLogs    string
+	bufferSize     uint
+	numberLines    bool
+	timeFormat     string
+	follow         bool
+	followName     bool
+	merge          bool
+	rotated        bool
+	recursive      bool
+	include        []string
+	exclude        []string
+	sortFiles      string
+	pid            int
+	minLevel       string
+	maxLevel       string
+	where          []string
+	grep           string
+	grepFixed      bool
+	ignoreCase     bool
+	grepField      string
+	since          string
+	until          string
+	untimed        string
+	mapping        []string
+	prefix         string
+	journald       bool
+	journalInclude []string
+	journalExclude []string
+	fields         []string
+	hideFields     []string
+	pinFields      []string
+	sortFields     bool
+	flatten        bool
+	flattenDepth   int
+	expand         bool
+	expandFields   int
+	expandWidth    int
+	config         string
+	profile        string
+	theme          string
+	themes         map[string]themeSpec
+	output         string
+	timeFormatSet  bool
+	files          []string
 }
 
 func newRootCommand() *cobra.Command {
@@ -57,15 +100,66 @@ func newRootCommand() *cobra.Command {
 		Version:       version,
 	}
 
+	cmd.SetGlobalNormalizationFunc(normalizeFlagName)
 	flags := cmd.PersistentFlags()
 	flags.StringVarP(&opts.timeFormat, "time-format", "t", defaultTimeFormat, `Set format for 'time' field using golang time format. e.g. "2006-01-02T15:04:05.999999999Z07:00"`)
+	flags.StringVarP(&opts.output, "output", "o", "text", `Set output format ("text"|"logfmt"|"json"). Unless --time-format is set, logfmt uses RFC3339 times. json always uses RFC3339 times and canonical level names.`)
+	flags.StringVar(&opts.theme, "theme", "auto", `Set color theme ("auto"|"dark"|"light"|"colorblind" or a custom theme from the config file). 256 and 24-bit colors are used if the terminal supports them.`)
 	flags.StringVar(&opts.coloredLogs, "color", "auto", `Show colored logs ("always"|"never"|"auto"). --color= is the same as --color=always.`)
 	flags.UintVar(&opts.bufferSize, "buffer-size", defaultBufferSize, `Set the read buffer size to buffer-size, in units of KiB (1024 bytes).`)
-	flags.BoolVarP(&opts.numberLines, "number", "n", false, `Number the output lines, starting at 1.`)
+	flags.BoolVarP(&opts.numberLines, "number", "n", false, `Number the output lines, starting at 1. Not supported with JSON output.`)
+	flags.BoolVarP(&opts.follow, "follow", "f", false, `Do not stop when the end of file is reached, but wait for additional data to be appended. Compressed and journal files can't be followed.`)
+	flags.BoolVarP(&opts.followName, "follow-name", "F", false, `The same as --follow, but reopen the file by name if it is renamed or recreated (e.g. by logrotate).`)
+	flags.BoolVar(&opts.merge, "merge", false, `Read all files at once and print their entries in time order, with the file name as the source. Lines without time stay after the preceding line.`)
+	flags.BoolVar(&opts.rotated, "rotated", false, `Read each file along with its rotated copies (e.g. app.log.2.gz, app.log.1, app-20240101.log.gz) from the oldest to the newest as a single stream.`)
+	flags.BoolVarP(&opts.recursive, "recursive", "r", false, `Read files of directories given as operands recursively.`)
+	flags.StringSliceVar(&opts.include, "include", nil, `Read only files with base names matching the given patterns, e.g. "*.log,*.json", when reading directories and glob patterns.`)
+	flags.StringSliceVar(&opts.exclude, "exclude", nil, `Skip files with base names matching the given patterns when reading directories and glob patterns.`)
+	flags.StringVar(&opts.sortFiles, "sort-files", "name", `Read files of directories and glob patterns sorted by "name" or by modification time ("mtime"), oldest first.`)
+	flags.IntVar(&opts.pid, "pid", 0, `With --follow, terminate after the process with the given pid dies.`)
+	flags.StringVarP(&opts.minLevel, "level", "l", "", `Show only entries with the given level or higher ("trace"|"debug"|"info"|"notice"|"warn"|"error"|"critical"|"fatal"|"panic"). --min-level is an alias.`)
+	flags.StringVar(&opts.maxLevel, "max-level", "", `Show only entries with the given level or lower.`)
+	flags.StringArrayVarP(&opts.where, "where", "w", nil, `Show only entries matching the query, e.g. "level>=warn and http.status=500". Supports =, !=, =~, !~, <, >, <=, >=, exists(key), and, or, not and parentheses. Can be repeated.`)
+	flags.StringVarP(&opts.grep, "grep", "g", "", `Show only entries with the message or any field value matching the regular expression. Matches are highlighted.`)
+	flags.BoolVar(&opts.grepFixed, "fixed-strings", false, `Interpret the --grep pattern as a fixed string, not a regular expression.`)
+	flags.BoolVarP(&opts.ignoreCase, "ignore-case", "i", false, `Ignore case distinctions in the --grep pattern.`)
+	flags.StringVar(&opts.grepField, "grep-field", "", `Limit the --grep search to the value of the given field, e.g. "http.path".`)
+	flags.StringVar(&opts.since, "since", "", `Show entries not older than the given time, e.g. "2006-01-02T15:04:05Z07:00", "2006-01-02 15:04", "15:04" (today) or "-15m" (relative to now).`)
+	flags.StringVar(&opts.until, "until", "", `Show entries older than the given time. Accepts the same values as --since.`)
+	flags.StringVar(&opts.untimed, "untimed", "inside", `What to do with entries without time when --since or --until is set ("inside"|"keep"|"drop"). "inside" shows them only after an entry within the range.`)
+	flags.StringSliceVar(&opts.mapping, "map", nil, `Use the given keys for time, level, msg, logger and caller, e.g. "time=@timestamp,msg=message". Several keys of the same role are checked in the specified order before the default ones.`)
+	flags.BoolVar(&opts.journald, "journald", false, `Show systemd journal entries (e.g. of "journalctl -o json") with SYSLOG_IDENTIFIER or _SYSTEMD_UNIT as the logger name.`)
+	flags.StringSliceVar(&opts.journalInclude, "journal-include", nil, `Show the given journal fields that are hidden by default, e.g. "_PID,_HOSTNAME,_COMM,_BOOT_ID". Glob patterns are supported. Implies --journald.`)
+	flags.StringSliceVar(&opts.journalExclude, "journal-exclude", nil, `Hide the given journal fields, e.g. "CODE_*". Glob patterns are supported. Implies --journald.`)
+	flags.StringVar(&opts.prefix, "prefix", "", `Strip the prefix matching the regular expression from lines and show it as the source, e.g. "(\S+) \| ". The first group is shown if any. kubectl --prefix and docker compose prefixes are recognized without it.`)
+	flags.StringSliceVar(&opts.fields, "fields", nil, `Print only the given fields in the given order, e.g. "status,duration". Glob patterns with '*' and '?' are supported.`)
+	flags.StringSliceVar(&opts.hideFields, "hide-fields", nil, `Do not print the given fields, e.g. "http.*,pid". Glob patterns with '*' and '?' are supported.`)
+	flags.StringSliceVar(&opts.pinFields, "pin-fields", nil, `Print the given fields first, right after the message, e.g. "request-id". Glob patterns with '*' and '?' are supported.`)
+	flags.BoolVar(&opts.sortFields, "sort-fields", false, `Print fields sorted by key. Pinned fields and --fields keep their order.`)
+	flags.BoolVar(&opts.flatten, "flatten", false, `Print nested objects as fields with dotted keys, e.g. http.req.method=GET, and arrays as [a, b].`)
+	flags.IntVar(&opts.flattenDepth, "flatten-depth", defaultFlattenDepth, `With --flatten, print objects nested deeper than the given depth as compact JSON.`)
+	flags.BoolVarP(&opts.expand, "expand", "x", false, `Print each field on its own indented line after the line with time, level, logger and message.`)
+	flags.IntVar(&opts.expandFields, "expand-fields", 0, `Expand entries with at least the given number of fields, and entries with multi-line values. 0 disables the check.`)
+	flags.IntVar(&opts.expandWidth, "expand-width", 0, `Expand entries longer than the given number of characters, and entries with multi-line values. 0 disables the check.`)
+	flags.StringVar(&opts.config, "config", "", `Load default values of options from the given file instead of "$XDG_CONFIG_HOME/hlogf/config" or "config.yaml". Files with .yaml or .yml extension are YAML, other files are TOML.`)
+	flags.StringVarP(&opts.profile, "profile", "p", "", `Use the named profile from the config file.`)
 	flags.BoolP("version", "v", false, "Print version information and exit.")
 	flags.BoolP("help", "h", false, "Print this help and exit.")
 
+	bindEnvUsage(flags)
+
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		// Options are taken from the command line, then from environment
+		// variables and then from the config file.
+		err := applyEnv(cmd.Flags())
+		if err != nil {
+			return err
+		}
+		opts.themes, err = handleConfigOptions(cmd.Flags(), opts.config, opts.profile)
+		if err != nil {
+			return err
+		}
+		opts.timeFormatSet = cmd.Flags().Changed("time-format")
 		opts.files = args
 
 		return runRoot(opts)
@@ -77,13 +171,64 @@ func newRootCommand() *cobra.Command {
 func runRoot(opts rootOptions) error {
 	signal.Ignore(os.Interrupt)
 
+	filters, err := handleFilterOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	grep, err := handleGrepOptions(opts)
+	if err != nil {
+		return err
+	}
+	if grep != nil {
+		filters = append(filters, grep)
+	}
+
+	timeRange, err := handleTimeRangeOptions(opts, time.Now())
+	if err != nil {
+		return err
+	}
+
+	mapping, err := handleMappingOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	prefix, err := handlePrefixOption(opts.prefix)
+	if err != nil {
+		return err
+	}
+
+	fields := handleFieldsOptions(opts)
+
+	output, timeFormat, err := handleOutputOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	noColor := handleColorOption(opts.coloredLogs)
+	theme, err := newTheme(opts.theme, opts.themes, detectColorDepth())
+	if err != nil {
+		return err
+	}
+
 	out := os.Stdout
 	scanOpts := Options{
-		NoColor:        handleColorOption(opts.coloredLogs),
+		NoColor:        noColor,
+		Theme:          theme,
+		Output:         output,
 		BufferSize:     handleBufferSize(opts.bufferSize),
 		NumberLines:    opts.numberLines,
 		StartingNumber: 1,
-		TimeFormat:     opts.timeFormat,
+		TimeFormat:     timeFormat,
+		Filters:        filters,
+		Grep:           grep,
+		TimeRange:      timeRange,
+		Mapping:        mapping,
+		Prefix:         prefix,
+		Fields:         fields,
+		FlattenDepth:   handleFlattenOptions(opts),
+		Expand:         handleExpandOptions(opts),
 	}
 
 	handleReader := func(r io.Reader) error {
@@ -96,38 +241,88 @@ func runRoot(opts rootOptions) error {
 		return nil
 	}
 
-	handleFile := func(name string) error {
-		f, err := os.Open(name)
+	// Journal files are shown in journald mode.
+	handleInput := func(name string) error {
+		in, err := openInput(name)
 		if err != nil {
 			return err
 		}
-		defer func() {
-			_ = f.Close()
-		}()
+		defer in.Close()
+
+		mapping := scanOpts.Mapping
+		if in.journal && mapping.journal == nil {
+			scanOpts.Mapping = mapping.withJournal(&journalFields{})
+			defer func() {
+				scanOpts.Mapping = mapping
+			}()
+		}
+
+		return handleReader(in)
+	}
+
+	// Rotated sets are read as a single stream.
+	handleRotated := func(name string) error {
+		files, err := findRotated(name)
+		if err != nil {
+			return err
+		}
+		r := &rotatedReader{names: files}
+		defer r.Close()
+
+		return handleReader(r)
+	}
+
+	// Directories and glob patterns are expanded to files.
+	finder, err := handleFileOptions(opts)
+	if err != nil {
+		return err
+	}
+	operands := opts.files
+	opts.files, err = finder.expand(operands)
+	if err != nil {
+		return err
+	}
+
+	if opts.pid != 0 && !opts.follow && !opts.followName {
+		return errors.New("--pid can't be used without --follow")
+	}
+
+	if opts.rotated && (opts.follow || opts.followName) {
+		return errors.New("--rotated can't be used with --follow")
+	}
+
+	if opts.merge {
+		if opts.follow || opts.followName {
+			return errors.New("--merge can't be used with --follow")
+		}
 
-		return handleReader(f)
+		return handleMerge(opts.files, opts.rotated, out, scanOpts)
 	}
 
-	if len(opts.files) == 0 {
+	if len(operands) == 0 {
 		// No files were specified. Read stdin.
-		return handleReader(os.Stdin)
+		return handleInput("-")
+	}
+
+	if opts.follow || opts.followName {
+		// New files of directories and glob patterns are followed too.
+		discover := func() []string {
+			files, _ := finder.expand(operands)
+
+			return files
+		}
+
+		return handleFollow(opts, discover, handleInput, handleReader)
 	}
 
 	// Scan all specified files.
 	for _, file := range opts.files {
-		var handle func() error
-		switch file {
-		case "-":
-			handle = func() error {
-				return handleReader(os.Stdin)
-			}
-		default:
-			handle = func() error {
-				return handleFile(file)
-			}
+		handle := handleInput
+		if opts.rotated && file != "-" {
+			handle = handleRotated
 		}
 
-		err := handle()
+		err := handle(file)
 		if err != nil {
 			return err
 		}
@@ -136,6 +331,282 @@ func runRoot(opts rootOptions) error {
 	return nil
 }
 
+// handleMerge handles 'merge' option. All files are read at once and
+// their entries are printed in time order. If rotated is true, each file
+// is read along with its rotated copies.
+func handleMerge(files []string, rotated bool, w io.Writer, opts Options) error {
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	var opened []*input
+	defer func() {
+		for _, in := range opened {
+			in.Close()
+		}
+	}()
+
+	inputs := make([]mergeInput, 0, len(files))
+	journal := false
+	for _, file := range files {
+		if rotated && file != "-" {
+			names, err := findRotated(file)
+			if err != nil {
+				return err
+			}
+			r := &rotatedReader{names: names}
+			defer r.Close()
+			inputs = append(inputs, mergeInput{name: file, r: r})
+
+			continue
+		}
+
+		in, err := openInput(file)
+		if err != nil {
+			return err
+		}
+		opened = append(opened, in)
+		inputs = append(inputs, mergeInput{name: in.name, r: in})
+		journal = journal || in.journal
+	}
+
+	// Journal files are shown in journald mode.
+	if journal && opts.Mapping.journal == nil {
+		opts.Mapping = opts.Mapping.withJournal(&journalFields{})
+	}
+
+	_, err := merge(inputs, w, opts)
+
+	return err
+}
+
+// handleFollow handles 'follow' option. All specified files are followed
+// at once producing a single stream of lines. New files returned by
+// discover are followed as they appear. Stdin is read with handleInput,
+// followed files with handleReader.
+func handleFollow(opts rootOptions, discover func() []string, handleInput func(string) error, handleReader func(io.Reader) error) error {
+	if len(opts.files) == 1 && opts.files[0] == "-" {
+		// There's nothing to follow in case of stdin. Just read it.
+		return handleInput("-")
+	}
+	for _, file := range opts.files {
+		if file == "-" {
+			return errors.New("standard input can't be followed along with files")
+		}
+	}
+
+	fr, err := newFollower(opts.files, opts.followName, opts.pid, int(handleBufferSize(opts.bufferSize)))
+	if err != nil {
+		return err
+	}
+	fr.discover = discover
+	defer func() {
+		_ = fr.Close()
+	}()
+
+	return handleReader(fr)
+}
+
+// handleConfigOptions handles 'config' and 'profile' options. Options
+// that are not specified in the command line are set from the config.
+// It returns custom themes defined in the config.
+func handleConfigOptions(flags *pflag.FlagSet, path, profile string) (map[string]themeSpec, error) {
+	c, err := loadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.themes, c.apply(flags, profile)
+}
+
+// handleFilterOptions handles all options that filter entries out.
+func handleFilterOptions(opts rootOptions) (Filters, error) {
+	var filters Filters
+
+	if opts.minLevel != "" || opts.maxLevel != "" {
+		var f levelFilter
+		var err error
+		if opts.minLevel != "" {
+			f.min, err = parseSeverityOption(opts.minLevel)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if opts.maxLevel != "" {
+			f.max, err = parseSeverityOption(opts.maxLevel)
+			if err != nil {
+				return nil, err
+			}
+		}
+		filters = append(filters, f)
+	}
+
+	for _, query := range opts.where {
+		f, err := compileQuery(query)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+
+	return filters, nil
+}
+
+// handleGrepOptions handles 'grep' and related options.
+func handleGrepOptions(opts rootOptions) (*grepFilter, error) {
+	if opts.grep == "" {
+		return nil, nil
+	}
+
+	return newGrepFilter(opts.grep, opts.grepFixed, opts.ignoreCase, opts.grepField)
+}
+
+// handleTimeRangeOptions handles 'since', 'until' and 'untimed' options.
+func handleTimeRangeOptions(opts rootOptions, now time.Time) (*timeRange, error) {
+	if opts.since == "" && opts.until == "" {
+		return nil, nil
+	}
+
+	var r timeRange
+	var err error
+	if opts.since != "" {
+		r.since, err = parseTimeOption(opts.since, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.until != "" {
+		r.until, err = parseTimeOption(opts.until, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r.policy, err = parseUntimedPolicy(opts.untimed)
+	if err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// handleMappingOptions handles 'map', 'journald', 'journal-include' and
+// 'journal-exclude' options.
+func handleMappingOptions(opts rootOptions) (*fieldMapping, error) {
+	mapping := defaultFieldMapping
+	if len(opts.mapping) != 0 {
+		var err error
+		mapping, err = parseFieldMapping(opts.mapping)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.journald || len(opts.journalInclude) != 0 || len(opts.journalExclude) != 0 {
+		mapping = mapping.withJournal(&journalFields{
+			include: opts.journalInclude,
+			exclude: opts.journalExclude,
+		})
+	}
+
+	return mapping, nil
+}
+
+// handlePrefixOption handles 'prefix' option.
+func handlePrefixOption(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+
+	re, err := compilePrefix(expr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prefix: %s", err)
+	}
+
+	return re, nil
+}
+
+// handleFileOptions handles 'recursive', 'include', 'exclude' and
+// 'sort-files' options.
+func handleFileOptions(opts rootOptions) (*fileFinder, error) {
+	for _, patterns := range [][]string{opts.include, opts.exclude} {
+		for _, p := range patterns {
+			_, err := filepath.Match(p, "")
+			if err != nil {
+				return nil, fmt.Errorf("bad file pattern %q: %s", p, err)
+			}
+		}
+	}
+
+	var byMtime bool
+	switch opts.sortFiles {
+	case "name":
+	case "mtime":
+		byMtime = true
+	default:
+		return nil, fmt.Errorf("unknown file order %q, expected one of name, mtime", opts.sortFiles)
+	}
+
+	return &fileFinder{
+		recursive: opts.recursive,
+		include:   opts.include,
+		exclude:   opts.exclude,
+		byMtime:   byMtime,
+		follow:    opts.follow || opts.followName,
+	}, nil
+}
+
+// handleFieldsOptions handles 'fields', 'hide-fields', 'pin-fields' and
+// 'sort-fields' options.
+func handleFieldsOptions(opts rootOptions) *fieldSelector {
+	return &fieldSelector{
+		only: opts.fields,
+		hide: opts.hideFields,
+		pin:  opts.pinFields,
+		sort: opts.sortFields,
+	}
+}
+
+// handleFlattenOptions handles 'flatten' and 'flatten-depth' options. It
+// returns zero if nested objects should not be flattened.
+func handleFlattenOptions(opts rootOptions) int {
+	if !opts.flatten || opts.flattenDepth < 0 {
+		return 0
+	}
+
+	return opts.flattenDepth
+}
+
+// handleExpandOptions handles 'expand', 'expand-fields' and 'expand-width'
+// options.
+func handleExpandOptions(opts rootOptions) expandPolicy {
+	return expandPolicy{
+		always: opts.expand,
+		fields: opts.expandFields,
+		width:  opts.expandWidth,
+	}
+}
+
+// handleOutputOptions handles 'output' option. It returns the output
+// format and the time format suitable for it.
+func handleOutputOptions(opts rootOptions) (outputFormat, string, error) {
+	output, err := parseOutputFormat(opts.output)
+	if err != nil {
+		return output, "", err
+	}
+	if output == outputJSON && opts.numberLines {
+		// Line numbers would break JSON lines.
+		return output, "", errors.New("--number can't be used with --output json")
+	}
+
+	timeFormat := opts.timeFormat
+	if output != outputText && !opts.timeFormatSet {
+		// Machine-readable formats need machine-readable times.
+		timeFormat = time.RFC3339Nano
+	}
+
+	return output, timeFormat, nil
+}
+
 // handleColorOption handles 'color' option. It returns true if colored
 // output should be turned off.
 func handleColorOption(coloredLogs string) bool {
@@ -169,7 +640,16 @@ Makes json logs possible to read by humans. Supports systemd journal.
 
 The hlogf reads and parses files sequentally, writing the colored logs to the standard output.
 The 'file' operands are processed in command-line order. If 'file' is a single dash '-' or
-absent, hlogf reads from the standard input.`
+absent, hlogf reads from the standard input. With --follow, all the files are read and then
+watched for new lines, the same as 'tail -f' does. With --rotated, each file is read along
+with its rotated copies as a single stream. With --merge, all the files are read at
+once and their entries are interleaved by time. Compressed files (gzip, bzip2, zstd, xz)
+and systemd journal files are read as well. Directories (with -r, recursively) and quoted
+glob patterns like 'logs/**/*.json' are expanded to files, skipping binary ones.
+
+Each option can also be set with the corresponding HLOGF_* environment variable or in the
+config file. The command line takes precedence over the environment and the environment
+over the config.`
 
 	example = `
   The command:
@@ -183,7 +663,14 @@ absent, hlogf reads from the standard input.`
   	hlogf file1 file2 > file3
 
   will sequentially parse the content of file1 and file2 and print parsed result to the file3,
-  truncating file3 if it already exists.`
+  truncating file3 if it already exists.
+
+  The command:
+
+  	hlogf -F --pid 1234 /var/log/app.log
+
+  will print the content of /var/log/app.log and then wait for new lines, reopening the file
+  when it's rotated, until the process 1234 dies.`
 
 	helpTemplate = `Usage: {{.Use}}
 {{.Short}}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// entryRole is a part of an entry with a special meaning.
+type entryRole int8
+
+const (
+	roleNone entryRole = iota
+	roleTime
+	roleLevel
+	roleMsg
+	roleLogger
+	roleCaller
+	roleCount
+)
+
+var roleNames = map[string]entryRole{
+	"time":   roleTime,
+	"level":  roleLevel,
+	"msg":    roleMsg,
+	"logger": roleLogger,
+	"caller": roleCaller,
+}
+
+// role returns a pointer to the value of the entry with the given role.
+func (e *Entry) role(r entryRole) *[]byte {
+	switch r {
+	case roleTime:
+		return &e.Time
+	case roleLevel:
+		return &e.Level
+	case roleMsg:
+		return &e.Msg
+	case roleLogger:
+		return &e.Name
+	default:
+		return &e.Caller
+	}
+}
+
+// Default keys for each role in priority order.
+var defaultRoleKeys = [roleCount][]string{
+	roleTime:   {"ts", "TS", "time", "TIME"},
+	roleLevel:  {"level", "LEVEL"},
+	roleMsg:    {"msg", "MESSAGE"},
+	roleLogger: {"logger", "LOGGER"},
+	roleCaller: {"caller", "CALLER"},
+}
+
+// mappedRole is a role of a key with the priority of the key among other
+// keys of the same role. The lower value means the higher priority.
+type mappedRole struct {
+	role     entryRole
+	priority int
+}
+
+// fieldMapping maps keys of a JSON object to roles of an entry.
+type fieldMapping struct {
+	keys map[string]mappedRole
+
+	// If journal is not nil, fields of systemd journal entries are
+	// selected by it.
+	journal *journalFields
+}
+
+// showField checks whether the field with the given key that is not
+// mapped to a role should be shown.
+func (m *fieldMapping) showField(key []byte) bool {
+	if m.journal != nil {
+		return m.journal.show(key)
+	}
+
+	return !hiddenJournalField(key)
+}
+
+// newFieldMapping creates a mapping with the given keys for each role.
+// The given keys have higher priority than the default ones.
+func newFieldMapping(keys [roleCount][]string) *fieldMapping {
+	m := &fieldMapping{keys: make(map[string]mappedRole)}
+
+	for r := roleNone + 1; r < roleCount; r++ {
+		for _, key := range append(keys[r], defaultRoleKeys[r]...) {
+			if _, ok := m.keys[key]; !ok {
+				m.keys[key] = mappedRole{r, len(m.keys)}
+			}
+		}
+	}
+
+	return m
+}
+
+// defaultFieldMapping is used when no custom mapping is specified.
+var defaultFieldMapping = newFieldMapping([roleCount][]string{})
+
+// parseFieldMapping parses a mapping specified by user as a list of
+// "role=key" pairs. Several keys of the same role are checked in the
+// specified order.
+func parseFieldMapping(specs []string) (*fieldMapping, error) {
+	var keys [roleCount][]string
+
+	for _, spec := range specs {
+		i := strings.IndexByte(spec, '=')
+		if i <= 0 || i == len(spec)-1 {
+			return nil, fmt.Errorf("bad mapping %q, expected role=key", spec)
+		}
+		name, key := spec[:i], spec[i+1:]
+
+		r, ok := roleNames[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("bad mapping %q, unknown role %q, expected one of time, level, msg, logger, caller", spec, name)
+		}
+		keys[r] = append(keys[r], key)
+	}
+
+	return newFieldMapping(keys), nil
+}
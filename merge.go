@@ -0,0 +1,149 @@
+package main
+
+import (
+	"io"
+	"time"
+	"unicode/utf8"
+)
+
+// In merge mode all inputs are read concurrently and their entries are
+// printed in time order. Each input is expected to be ordered by time
+// itself, so the next entry is the earliest of the next entries of the
+// inputs. Lines without time, e.g. continuation lines of stack traces,
+// stay attached to the preceding line with time.
+
+// Capacity of the channel of line groups of each input.
+const mergeChannelCapacity = 64
+
+// mergeInput is an input of merge mode. The name is shown as the source
+// of its lines.
+type mergeInput struct {
+	name string
+	r    io.Reader
+}
+
+// mergeGroup is a line with time followed by lines without time. Lines
+// at the beginning of an input that have no time go in a group with zero
+// time.
+type mergeGroup struct {
+	time  time.Time
+	lines [][]byte
+}
+
+// merge reads all inputs and writes formatted entries to w in time order.
+// It returns the number of the next line.
+func merge(inputs []mergeInput, w io.Writer, opts Options) (int, error) {
+	if opts.Mapping == nil {
+		opts.Mapping = defaultFieldMapping
+	}
+
+	// Names are shown as a column.
+	labels := make([][]byte, len(inputs))
+	for i, in := range inputs {
+		labels[i] = []byte(in.name)
+		if n := utf8.RuneCountInString(in.name); n > opts.SourceWidth {
+			opts.SourceWidth = n
+		}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	groups := make([]chan mergeGroup, len(inputs))
+	errs := make([]error, len(inputs))
+	for i := range inputs {
+		groups[i] = make(chan mergeGroup, mergeChannelCapacity)
+		go func(i int) {
+			defer close(groups[i])
+			errs[i] = readGroups(inputs[i].r, opts, groups[i], done)
+		}(i)
+	}
+
+	return process(w, opts, func(send func(data, source []byte)) error {
+		heads := make([]mergeGroup, len(inputs))
+		live := make([]bool, len(inputs))
+
+		// next receives the next group of the input.
+		next := func(i int) error {
+			heads[i], live[i] = <-groups[i]
+			if !live[i] {
+				return errs[i]
+			}
+
+			return nil
+		}
+		for i := range inputs {
+			err := next(i)
+			if err != nil {
+				return err
+			}
+		}
+
+		for {
+			// Inputs are few, so the earliest group is just searched for.
+			// Groups with the same time keep the order of inputs.
+			earliest := -1
+			for i := range heads {
+				if live[i] && (earliest == -1 || heads[i].time.Before(heads[earliest].time)) {
+					earliest = i
+				}
+			}
+			if earliest == -1 {
+				return nil
+			}
+
+			for _, line := range heads[earliest].lines {
+				send(line, labels[earliest])
+			}
+
+			err := next(earliest)
+			if err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// readGroups reads lines of r and sends them to ch in groups. It stops
+// sending when done is closed.
+func readGroups(r io.Reader, opts Options, ch chan<- mergeGroup, done <-chan struct{}) error {
+	var e Entry
+	var g mergeGroup
+	stopped := false
+
+	emit := func() {
+		select {
+		case ch <- g:
+		case <-done:
+			stopped = true
+		}
+		g = mergeGroup{}
+	}
+
+	err := scanLines(r, make([]byte, opts.BufferSize), func(data []byte) {
+		if stopped {
+			return
+		}
+
+		// Lines are kept until their group is printed.
+		line := append([]byte(nil), data...)
+
+		var t time.Time
+		ok := parseEntry(line, opts, &e)
+		if ok {
+			t, ok = encodeTime(e.Time)
+		}
+		if ok {
+			if len(g.lines) != 0 {
+				emit()
+			}
+			g.time = t
+		}
+		g.lines = append(g.lines, line)
+	})
+	if len(g.lines) != 0 && !stopped {
+		emit()
+	}
+
+	return err
+}
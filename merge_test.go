@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	inputs := []mergeInput{
+		{"api", strings.NewReader(
+			`{"time":"2024-01-01T00:00:01Z","msg":"a1"}` + "\n" +
+				`{"time":"2024-01-01T00:00:04Z","msg":"a2"}` + "\n" +
+				"trace\n" +
+				`{"time":"2024-01-01T00:00:04Z","msg":"a3"}` + "\n")},
+		{"db", strings.NewReader(
+			"untimed\n" +
+				`{"time":"2024-01-01T00:00:02Z","msg":"d1"}` + "\n" +
+				`{"time":"2024-01-01T00:00:04Z","msg":"d2"}` + "\n" +
+				`{"time":"2024-01-01T00:00:05Z","msg":"d3"}` + "\n")},
+	}
+
+	var b bytes.Buffer
+	next, err := merge(inputs, &b, Options{NoColor: true, Output: outputJSON, StartingNumber: 1, BufferSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != 9 {
+		t.Errorf("unexpected next number: %d", next)
+	}
+
+	expected := []string{
+		`{"source":"db","msg":"untimed"}`,
+		`{"source":"api","time":"2024-01-01T00:00:01Z","msg":"a1"}`,
+		`{"source":"db","time":"2024-01-01T00:00:02Z","msg":"d1"}`,
+		`{"source":"api","time":"2024-01-01T00:00:04Z","msg":"a2"}`,
+		`{"source":"api","msg":"trace"}`,
+		`{"source":"api","time":"2024-01-01T00:00:04Z","msg":"a3"}`,
+		`{"source":"db","time":"2024-01-01T00:00:04Z","msg":"d2"}`,
+		`{"source":"db","time":"2024-01-01T00:00:05Z","msg":"d3"}`,
+	}
+	r := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if strings.Join(r, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected result:\n%s\nexpected:\n%s", strings.Join(r, "\n"), strings.Join(expected, "\n"))
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"github.com/ssgreg/logf"
+)
+
+// Default depth of nested objects that are flattened with --flatten.
+const defaultFlattenDepth = 3
+
+// flattenFields appends the fields to dst replacing fields with nested
+// objects by fields with dotted keys, e.g. {"http":{"method":"GET"}}
+// becomes http.method="GET". Objects nested deeper than the flatten depth
+// are kept as is. Keys are stored in the formatter's key arena.
+func (f *formatter) flattenFields(fields []Field, dst []Field) []Field {
+	f.keys = f.keys[:0]
+	for _, field := range fields {
+		dst = f.flattenField(dst, field.Key, field.Value, 1)
+	}
+
+	return dst
+}
+
+func (f *formatter) flattenField(dst []Field, key, val []byte, depth int) []Field {
+	if depth > f.flattenDepth || len(val) == 0 || val[0] != '{' {
+		return append(dst, Field{Key: key, Value: val})
+	}
+	if _, ok := parseErrorObject(val); ok {
+		// Errors are printed as stack traces.
+		return append(dst, Field{Key: key, Value: val})
+	}
+
+	n := len(dst)
+	ok := walkObject(val, func(k, v []byte) bool {
+		// Slices of the arena stay valid when it grows, as the data
+		// they point to is never changed until the next entry.
+		start := len(f.keys)
+		f.keys = append(f.keys, key...)
+		f.keys = append(f.keys, '.')
+		f.keys = append(f.keys, k...)
+		dst = f.flattenField(dst, f.keys[start:len(f.keys):len(f.keys)], v, depth+1)
+
+		return true
+	})
+	if !ok || len(dst) == n {
+		// Keep malformed and empty objects as is.
+		return append(dst[:n], Field{Key: key, Value: val})
+	}
+
+	return dst
+}
+
+// appendNestedValue appends a value of a field in the text format. Arrays
+// are printed as [a, b] with unquoted strings, objects are printed as
+// compact JSON with keys colored like top-level ones. Other values are
+// printed the same way as without flattening.
+func (f *formatter) appendNestedValue(buf *logf.Buffer, val []byte, highlight bool) {
+	if len(val) == 0 || (val[0] != '[' && val[0] != '{') {
+		f.appendText(buf, val, highlight, f.theme.Value)
+
+		return
+	}
+
+	start := buf.Len()
+	if !f.appendCompact(buf, val, highlight, true) {
+		// Malformed value, print it as is.
+		buf.Data = buf.Data[:start]
+		f.appendText(buf, val, highlight, f.theme.Value)
+	}
+}
+
+// appendCompact appends a nested value. If inArray is true, strings are
+// unquoted. It returns false if the value is malformed.
+func (f *formatter) appendCompact(buf *logf.Buffer, val []byte, highlight, inArray bool) bool {
+	th := f.theme
+
+	switch {
+	case len(val) != 0 && val[0] == '[':
+		buf.AppendByte('[')
+		first := true
+		ok := walkArray(val, func(v []byte) bool {
+			if !first {
+				buf.AppendString(", ")
+			}
+			first = false
+
+			return f.appendCompact(buf, v, highlight, true)
+		})
+		buf.AppendByte(']')
+
+		return ok
+
+	case len(val) != 0 && val[0] == '{':
+		buf.AppendByte('{')
+		first := true
+		ok := walkObject(val, func(k, v []byte) bool {
+			if !first {
+				buf.AppendByte(',')
+			}
+			first = false
+
+			th.Key.at(buf, func() {
+				buf.AppendByte('"')
+				buf.AppendBytes(k)
+				buf.AppendByte('"')
+			})
+			th.Separator.at(buf, func() {
+				buf.AppendByte(':')
+			})
+			buf.AppendString(string(th.Value))
+
+			return f.appendCompact(buf, v, highlight, false)
+		})
+		buf.AppendByte('}')
+
+		return ok
+
+	case inArray && len(val) >= 2 && val[0] == '"':
+		f.appendText(buf, val[1:len(val)-1], highlight, th.Value)
+
+	default:
+		f.appendText(buf, val, highlight, th.Value)
+	}
+
+	return true
+}
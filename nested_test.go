@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ssgreg/logf"
+)
+
+func TestFlattenFields(t *testing.T) {
+	var e Entry
+	if !parse([]byte(`{"msg":"m","http":{"req":{"method":"GET","h":{"a":1}},"status":200},"tags":["a","b c",{"x":1}],"e":{}}`), defaultFieldMapping, &e) {
+		t.Fatal("failed to parse")
+	}
+
+	f := newFormatter(Options{NoColor: true, FlattenDepth: 2})
+	buf := logf.NewBuffer()
+	for _, field := range f.fieldsOf(&e) {
+		buf.AppendBytes(field.Key)
+		buf.AppendByte('=')
+		f.appendNestedValue(buf, field.Value, false)
+		buf.AppendByte(' ')
+	}
+
+	expected := `http.req.method="GET" http.req.h={"a":1} http.status=200 tags=[a, b c, {"x":1}] e={}`
+	if r := strings.TrimSpace(buf.String()); r != expected {
+		t.Errorf("expected %s, got %s", expected, r)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// Tools that merge logs of several sources put a label in front of each
+// line:
+//
+//   - kubectl logs --prefix: "[pod/name/container] {...}";
+//   - docker compose logs: "service-1  | {...}".
+//
+// The label is kept as the source of the entry. JSON objects are also
+// found after arbitrary leading text, which is used as the source then.
+
+// parsePrefixed parses a line with a known prefix or with an embedded JSON
+// object to the given entry. The entry is expected to be reset.
+func parsePrefixed(data []byte, m *fieldMapping, t *Entry) bool {
+	if label, rest, ok := cutKnownPrefix(data); ok {
+		if parseLine(rest, m, t) {
+			t.Source = label
+
+			return true
+		}
+		t.reset()
+	}
+
+	// Embedded JSON object.
+	i := bytes.IndexByte(data, '{')
+	if i <= 0 || data[len(data)-1] != '}' {
+		return false
+	}
+	if !parseJSON(data[i:], m, t) {
+		return false
+	}
+	t.Source = bytes.TrimRight(data[:i], " \t|:")
+
+	return true
+}
+
+// cutKnownPrefix cuts a prefix of kubectl or docker compose from the line.
+// It returns the label and the rest of the line.
+func cutKnownPrefix(data []byte) ([]byte, []byte, bool) {
+	// kubectl logs --prefix.
+	if len(data) != 0 && data[0] == '[' {
+		i := bytes.IndexByte(data, ']')
+		if i > 1 && i+1 < len(data) && data[i+1] == ' ' {
+			return data[1:i], data[i+2:], true
+		}
+	}
+
+	// docker compose logs.
+	if i := bytes.Index(data, []byte(" | ")); i > 0 {
+		label := bytes.TrimRight(data[:i], " ")
+		if len(label) != 0 && bytes.IndexByte(label, ' ') == -1 {
+			return label, data[i+3:], true
+		}
+	}
+
+	return nil, nil, false
+}
+
+// parseUserPrefix parses a line with a prefix matching the given regular
+// expression to the given entry. The first group of the expression is
+// used as the source if any, the whole match otherwise. It returns false
+// if the prefix doesn't match or the rest of the line is not parsed.
+func parseUserPrefix(data []byte, re *regexp.Regexp, m *fieldMapping, t *Entry) bool {
+	loc := re.FindSubmatchIndex(data)
+	if loc == nil || loc[0] != 0 {
+		return false
+	}
+
+	if !parseLine(data[loc[1]:], m, t) {
+		return false
+	}
+
+	t.Source = bytes.TrimSpace(data[:loc[1]])
+	if len(loc) >= 4 && loc[2] >= 0 {
+		t.Source = data[loc[2]:loc[3]]
+	}
+
+	return true
+}
+
+// compilePrefix compiles a regular expression of line prefixes. The
+// expression is anchored to the beginning of the line.
+func compilePrefix(expr string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + expr + `)`)
+}
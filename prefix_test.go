@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParsePrefixed(t *testing.T) {
+	cases := []struct {
+		line   string
+		source string
+		msg    string
+	}{
+		{`[pod/api-1/app] {"msg":"k8s"}`, "pod/api-1/app", `"k8s"`},
+		{`api-1  | level=info msg=compose`, "api-1", `"compose"`},
+		{`2024-01-01 app: {"msg":"embedded"}`, "2024-01-01 app", `"embedded"`},
+	}
+
+	for _, c := range cases {
+		var e Entry
+		if !parse([]byte(c.line), defaultFieldMapping, &e) {
+			t.Errorf("%s: failed to parse", c.line)
+
+			continue
+		}
+		if string(e.Source) != c.source || string(e.Msg) != c.msg {
+			t.Errorf("%s: expected %q %s, got %q %s", c.line, c.source, c.msg, e.Source, e.Msg)
+		}
+	}
+
+	var e Entry
+	if parse([]byte(`just text | with bar`), defaultFieldMapping, &e) {
+		t.Errorf("expected plain text not to be parsed")
+	}
+
+	re, err := compilePrefix(`<(\S+)> `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.reset()
+	if !parseUserPrefix([]byte(`<svc> {"msg":"user"}`), re, defaultFieldMapping, &e) || string(e.Source) != "svc" {
+		t.Errorf("expected user prefix to be parsed, got %q", e.Source)
+	}
+}
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The query language selects entries by their fields. Examples:
+//
+// 	level>=warn and http.status=500
+// 	not exists(error) or msg=~"^request (done|failed)$"
+// 	tags[0]!=debug and (attempt>3 or duration>=1.5)
+//
+// Keys are paths to values of an entry. Nested objects and arrays are
+// addressed with dots and indexes. The names 'time', 'level', 'msg',
+// 'logger' and 'caller' refer to the corresponding parts of the entry
+// regardless of the actual key names.
+
+// queryNode is a node of a compiled query.
+type queryNode interface {
+	match(e *Entry) bool
+}
+
+// queryFilter matches entries using a compiled query.
+type queryFilter struct {
+	root queryNode
+}
+
+func (f queryFilter) Match(e *Entry) bool {
+	return f.root.match(e)
+}
+
+// compileQuery parses the given query.
+func compileQuery(query string) (queryFilter, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return queryFilter{}, err
+	}
+
+	p := queryParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return queryFilter{}, err
+	}
+	if p.peek().kind != tokenEnd {
+		return queryFilter{}, p.unexpected()
+	}
+
+	return queryFilter{root}, nil
+}
+
+type tokenKind int8
+
+const (
+	tokenEnd tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOp
+	tokenLParen
+	tokenRParen
+)
+
+type queryToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func tokenizeQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(':
+			tokens = append(tokens, queryToken{tokenLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, queryToken{tokenRParen, ")", i})
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			for ; end < len(query) && query[end] != c; end++ {
+				if c == '"' && query[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(query) {
+				return nil, fmt.Errorf("query: unterminated string at position %d", i)
+			}
+			text := query[i+1 : end]
+			if c == '"' {
+				var err error
+				text, err = strconv.Unquote(query[i : end+1])
+				if err != nil {
+					return nil, fmt.Errorf("query: bad string at position %d: %s", i, err)
+				}
+			}
+			tokens = append(tokens, queryToken{tokenString, text, i})
+			i = end + 1
+		case strings.IndexByte("=!<>~&|", c) != -1:
+			op := query[i : i+1]
+			if i+1 < len(query) {
+				switch two := query[i : i+2]; two {
+				case "!=", "=~", "!~", "<=", ">=", "&&", "||", "==":
+					op = two
+				}
+			}
+			tokens = append(tokens, queryToken{tokenOp, op, i})
+			i += len(op)
+		default:
+			end := i
+			for ; end < len(query); end++ {
+				if strings.IndexByte(" \t\r\n()=!<>~&|\"'", query[end]) != -1 {
+					break
+				}
+			}
+			tokens = append(tokens, queryToken{tokenWord, query[i:end], i})
+			i = end
+		}
+	}
+
+	return append(tokens, queryToken{tokenEnd, "", len(query)}), nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEnd {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *queryParser) unexpected() error {
+	t := p.peek()
+	if t.kind == tokenEnd {
+		return fmt.Errorf("query: unexpected end of query")
+	}
+
+	return fmt.Errorf("query: unexpected %q at position %d", t.text, t.pos)
+}
+
+// isKeyword checks whether the next token is the given keyword or one of
+// its symbolic aliases.
+func (p *queryParser) isKeyword(keyword, alias string) bool {
+	t := p.peek()
+	switch t.kind {
+	case tokenWord:
+		return strings.EqualFold(t.text, keyword)
+	case tokenOp:
+		return t.text == alias
+	}
+
+	return false
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isKeyword("or", "||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isKeyword("and", "&&") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *queryParser) parseNot() (queryNode, error) {
+	if p.isKeyword("not", "!") {
+		p.next()
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return notNode{node}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokenLParen:
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokenRParen {
+			return nil, p.unexpected()
+		}
+		p.next()
+
+		return node, nil
+
+	case t.kind == tokenWord && strings.EqualFold(t.text, "exists") && p.tokens[p.pos+1].kind == tokenLParen:
+		p.pos += 2
+		key := p.next()
+		if key.kind != tokenWord && key.kind != tokenString {
+			p.pos--
+
+			return nil, p.unexpected()
+		}
+		if p.peek().kind != tokenRParen {
+			return nil, p.unexpected()
+		}
+		p.next()
+		path, err := parseQueryPath(key.text)
+		if err != nil {
+			return nil, err
+		}
+
+		return existsNode{path}, nil
+
+	case t.kind == tokenWord || t.kind == tokenString:
+		return p.parseComparison()
+	}
+
+	return nil, p.unexpected()
+}
+
+func (p *queryParser) parseComparison() (queryNode, error) {
+	key := p.next()
+	path, err := parseQueryPath(key.text)
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.peek()
+	if op.kind != tokenOp {
+		return nil, p.unexpected()
+	}
+	p.next()
+
+	value := p.peek()
+	if value.kind != tokenWord && value.kind != tokenString {
+		return nil, p.unexpected()
+	}
+	p.next()
+
+	switch op.text {
+	case "=", "==", "!=":
+		node := compareNode{path: path, value: []byte(value.text), op: "="}
+		if path.role == roleLevel {
+			node.severity = severityNames[strings.ToLower(value.text)]
+		}
+		if op.text == "!=" {
+			return notNode{node}, nil
+		}
+
+		return node, nil
+
+	case "=~", "!~":
+		re, err := regexp.Compile(value.text)
+		if err != nil {
+			return nil, fmt.Errorf("query: bad regular expression at position %d: %s", value.pos, err)
+		}
+		node := regexpNode{path, re}
+		if op.text == "!~" {
+			return notNode{node}, nil
+		}
+
+		return node, nil
+
+	case "<", ">", "<=", ">=":
+		node := compareNode{path: path, value: []byte(value.text), op: op.text}
+		if path.role == roleLevel {
+			node.severity = severityNames[strings.ToLower(value.text)]
+			if node.severity != SeverityUnknown {
+				return node, nil
+			}
+		}
+		node.number, err = strconv.ParseFloat(value.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("query: number expected at position %d, got %q", value.pos, value.text)
+		}
+
+		return node, nil
+	}
+
+	return nil, fmt.Errorf("query: unexpected %q at position %d", op.text, op.pos)
+}
+
+type andNode struct {
+	left, right queryNode
+}
+
+func (n andNode) match(e *Entry) bool {
+	return n.left.match(e) && n.right.match(e)
+}
+
+type orNode struct {
+	left, right queryNode
+}
+
+func (n orNode) match(e *Entry) bool {
+	return n.left.match(e) || n.right.match(e)
+}
+
+type notNode struct {
+	node queryNode
+}
+
+func (n notNode) match(e *Entry) bool {
+	return !n.node.match(e)
+}
+
+type existsNode struct {
+	path queryPath
+}
+
+func (n existsNode) match(e *Entry) bool {
+	_, ok := n.path.lookup(e)
+
+	return ok
+}
+
+type regexpNode struct {
+	path queryPath
+	re   *regexp.Regexp
+}
+
+func (n regexpNode) match(e *Entry) bool {
+	v, ok := n.path.lookup(e)
+
+	return ok && n.re.Match(textValue(v))
+}
+
+// compareNode compares a value by equality, or as numbers, or as levels.
+type compareNode struct {
+	path     queryPath
+	op       string
+	value    []byte
+	number   float64
+	severity Severity
+}
+
+func (n compareNode) match(e *Entry) bool {
+	v, ok := n.path.lookup(e)
+	if !ok {
+		return false
+	}
+
+	if n.severity != SeverityUnknown {
+		s := parseSeverity(v)
+		if s == SeverityUnknown {
+			return false
+		}
+
+		return compareOrdered(n.op, int(s), int(n.severity))
+	}
+
+	if n.op == "=" {
+		return bytes.Equal(textValue(v), n.value)
+	}
+
+	number, err := strconv.ParseFloat(bytesToString(textValue(v)), 64)
+	if err != nil {
+		return false
+	}
+
+	switch n.op {
+	case "<":
+		return number < n.number
+	case ">":
+		return number > n.number
+	case "<=":
+		return number <= n.number
+	default:
+		return number >= n.number
+	}
+}
+
+func compareOrdered(op string, a, b int) bool {
+	switch op {
+	case "=":
+		return a == b
+	case "<":
+		return a < b
+	case ">":
+		return a > b
+	case "<=":
+		return a <= b
+	default:
+		return a >= b
+	}
+}
+
+// queryPathSegment is a key of an object or an index of an array.
+type queryPathSegment struct {
+	key   string
+	index int
+}
+
+// queryPath is a path to a value of an entry.
+type queryPath struct {
+	full     string
+	role     entryRole
+	segments []queryPathSegment
+}
+
+func parseQueryPath(s string) (queryPath, error) {
+	path := queryPath{full: s, role: roleNames[s]}
+
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end == -1 {
+				return path, fmt.Errorf("query: bad key %q: missing ']'", s)
+			}
+			index, err := strconv.Atoi(s[i+1 : i+end])
+			if err != nil || index < 0 {
+				return path, fmt.Errorf("query: bad key %q: bad index %q", s, s[i+1:i+end])
+			}
+			path.segments = append(path.segments, queryPathSegment{index: index})
+			i += end + 1
+		case '.':
+			i++
+		default:
+			end := strings.IndexAny(s[i:], ".[")
+			if end == -1 {
+				end = len(s) - i
+			}
+			path.segments = append(path.segments, queryPathSegment{key: s[i : i+end], index: -1})
+			i += end
+		}
+	}
+	if len(path.segments) == 0 || path.segments[0].index != -1 {
+		return path, fmt.Errorf("query: bad key %q", s)
+	}
+
+	return path, nil
+}
+
+// lookup returns a JSON value of the entry the path points to.
+func (p queryPath) lookup(e *Entry) ([]byte, bool) {
+	if p.role != roleNone {
+		v := *e.role(p.role)
+
+		return v, len(v) != 0
+	}
+
+	var v []byte
+	found := false
+	for _, f := range e.Fields {
+		// Keys containing dots are checked as well.
+		if bytesToString(f.Key) == p.full {
+			return f.Value, true
+		}
+		if !found && bytesToString(f.Key) == p.segments[0].key {
+			v, found = f.Value, true
+		}
+	}
+	if !found {
+		return nil, false
+	}
+
+	for _, s := range p.segments[1:] {
+		v, found = lookupJSON(v, s)
+		if !found {
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+// lookupJSON returns a value of an object by key or of an array by index.
+func lookupJSON(v []byte, s queryPathSegment) ([]byte, bool) {
+	var r []byte
+	found := false
+
+	if s.index == -1 {
+		walkObject(v, func(key, val []byte) bool {
+			if bytesToString(key) == s.key {
+				r, found = val, true
+			}
+
+			return !found
+		})
+	} else {
+		i := 0
+		walkArray(v, func(val []byte) bool {
+			if i == s.index {
+				r, found = val, true
+			}
+			i++
+
+			return !found
+		})
+	}
+
+	return r, found
+}
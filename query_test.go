@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+)
+
+var queryGolden = []byte(`{"level":"warn","ts":"2018-12-13T22:21:26.84954039+03:00","logger":"token","msg":"request done","http":{"status":500,"req":{"method":"GET"}},"tags":["db","slow"],"attempt":3,"dotted.key":"x","text":"a \"quoted\" word"}`)
+
+func TestQuery(t *testing.T) {
+	var e Entry
+	if !parse(queryGolden, defaultFieldMapping, &e) {
+		t.Fatal("failed to parse golden entry")
+	}
+	adoptEntry(&e)
+
+	cases := []struct {
+		query    string
+		expected bool
+	}{
+		{`level=warn`, true},
+		{`level=warning`, true},
+		{`level>=error`, false},
+		{`level<error and level>info`, true},
+		{`msg="request done"`, true},
+		{`msg!="request done"`, false},
+		{`logger=~^tok`, true},
+		{`logger!~^tok`, false},
+		{`http.status=500`, true},
+		{`http.status>=500 && http.status<600`, true},
+		{`http.req.method=GET`, true},
+		{`http.req.path=GET`, false},
+		{`tags[1]=slow`, true},
+		{`tags[2]=slow`, false},
+		{`attempt>3`, false},
+		{`attempt<=3`, true},
+		{`dotted.key=x`, true},
+		{`text='a "quoted" word'`, true},
+		{`exists(http.req) and not exists(error)`, true},
+		{`!(exists(http) || exists(tags))`, false},
+		{`missing=1 or (attempt=3 and level=warn)`, true},
+		{`missing!=1`, true},
+	}
+
+	for _, c := range cases {
+		f, err := compileQuery(c.query)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.query, err)
+
+			continue
+		}
+		if f.Match(&e) != c.expected {
+			t.Errorf("%s: expected %v", c.query, c.expected)
+		}
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	cases := []string{
+		``,
+		`level`,
+		`level=`,
+		`(level=warn`,
+		`level=warn)`,
+		`attempt>three`,
+		`msg=~"("`,
+		`tags[x]=1`,
+		`exists()`,
+		`msg="unterminated`,
+	}
+
+	for _, c := range cases {
+		if _, err := compileQuery(c); err == nil {
+			t.Errorf("%s: expected an error", c)
+		}
+	}
+}
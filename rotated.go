@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A rotated set of a log file, e.g. "app.log", consists of the file
+// itself and its rotated copies, possibly compressed:
+//
+//   - numbered ones, e.g. "app.log.1" or "app.log.2.gz", where a bigger
+//     number means an older file;
+//   - dated ones, e.g. "app.log-20240101", "app-20240101.log.gz" or
+//     "app.2024-01-01.log", which are ordered by date.
+//
+// Dated files are considered older than numbered ones, as both kinds are
+// rarely mixed in the same set.
+
+// Maximum number of digits of a rotation number. Longer numbers are
+// dates.
+const maxRotationNumberLen = 5
+
+// Kinds of files of a rotated set in order from the oldest.
+const (
+	rotatedDated = iota
+	rotatedNumbered
+	rotatedCurrent
+)
+
+// rotatedFile is a file of a rotated set.
+type rotatedFile struct {
+	name   string
+	kind   int
+	date   string
+	number int
+}
+
+// findRotated returns files of the rotated set of the given log file
+// ordered from the oldest to the newest.
+func findRotated(name string) ([]string, error) {
+	dir, base := filepath.Split(name)
+	infos, err := ioutil.ReadDir(filepath.Join(dir, "."))
+	if err != nil {
+		return nil, err
+	}
+
+	var files []rotatedFile
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		f, ok := parseRotatedName(base, info.Name())
+		if !ok {
+			continue
+		}
+		f.name = dir + info.Name()
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files of the rotated set of %s", name)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		switch {
+		case a.kind != b.kind:
+			return a.kind < b.kind
+		case a.kind == rotatedDated && a.date != b.date:
+			return a.date < b.date
+		case a.kind == rotatedNumbered && a.number != b.number:
+			return a.number > b.number
+		}
+
+		return a.name < b.name
+	})
+
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.name
+	}
+
+	return names, nil
+}
+
+// parseRotatedName checks whether the file name belongs to the rotated set
+// of the base name and returns its kind and position in the set.
+func parseRotatedName(base, name string) (rotatedFile, bool) {
+	f := rotatedFile{kind: rotatedCurrent}
+	for _, c := range compressions {
+		if strings.HasSuffix(name, c.ext) {
+			name = strings.TrimSuffix(name, c.ext)
+
+			break
+		}
+	}
+	if name == base {
+		return f, true
+	}
+
+	// The suffix is added either to the whole name, e.g. "app.log.1", or
+	// before the extension, e.g. "app.1.log".
+	ext := filepath.Ext(base)
+	for _, form := range [][2]string{{base, ""}, {strings.TrimSuffix(base, ext), ext}} {
+		prefix, suffix := form[0], form[1]
+		if len(name) <= len(prefix)+len(suffix)+1 || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		sep := name[len(prefix)]
+		if sep != '.' && sep != '-' && sep != '_' {
+			continue
+		}
+		mid := name[len(prefix)+1 : len(name)-len(suffix)]
+
+		if n, ok := atoi(mid); ok && sep == '.' && len(mid) <= maxRotationNumberLen {
+			f.kind = rotatedNumbered
+			f.number = n
+
+			return f, true
+		}
+		if date, ok := parseRotationDate(mid); ok {
+			f.kind = rotatedDated
+			f.date = date
+
+			return f, true
+		}
+	}
+
+	return f, false
+}
+
+// parseRotationDate checks whether the suffix of a rotated file is a date,
+// e.g. "20240101" or "2024-01-01", and returns its digits.
+func parseRotationDate(s string) (string, bool) {
+	if len(s) == 0 || s[0] < '0' || s[0] > '9' {
+		return "", false
+	}
+
+	digits := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case '0' <= c && c <= '9':
+			digits = append(digits, c)
+		case c == '-' || c == '_':
+		default:
+			return "", false
+		}
+	}
+	if len(digits) <= maxRotationNumberLen {
+		return "", false
+	}
+
+	return string(digits), true
+}
+
+// rotatedReader reads files one after another as a single stream. Files
+// are opened when they are reached. A newline is added after a file that
+// doesn't end with it, so lines of different files are not joined.
+type rotatedReader struct {
+	names []string
+	in    *input
+	last  byte
+}
+
+// Read implements io.Reader.
+func (r *rotatedReader) Read(p []byte) (int, error) {
+	for {
+		if r.in == nil {
+			if len(r.names) == 0 {
+				return 0, io.EOF
+			}
+			in, err := openInput(r.names[0])
+			if err != nil {
+				return 0, err
+			}
+			r.names = r.names[1:]
+			r.in = in
+			r.last = '\n'
+		}
+
+		n, err := r.in.Read(p)
+		if n > 0 {
+			r.last = p[n-1]
+
+			return n, nil
+		}
+		switch {
+		case err == io.EOF:
+			r.in.Close()
+			r.in = nil
+			if r.last != '\n' && len(p) != 0 {
+				p[0] = '\n'
+
+				return 1, nil
+			}
+		case err != nil:
+			return 0, err
+		}
+	}
+}
+
+// Close closes the file that is being read.
+func (r *rotatedReader) Close() {
+	if r.in != nil {
+		r.in.Close()
+		r.in = nil
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindRotated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hlogf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	names := []string{
+		"app.log", "app.log.1", "app.log.2.gz", "app.log.10.zst",
+		"app-20240102.log.gz", "app.log-20240101", "app.2024-01-03.log",
+		"app-worker.log", "app.log.bak", "other.log.1",
+	}
+	for _, name := range names {
+		err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := findRotated(filepath.Join(dir, "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range files {
+		files[i] = filepath.Base(files[i])
+	}
+
+	expected := []string{
+		"app.log-20240101", "app-20240102.log.gz", "app.2024-01-03.log",
+		"app.log.10.zst", "app.log.2.gz", "app.log.1", "app.log",
+	}
+	if strings.Join(files, " ") != strings.Join(expected, " ") {
+		t.Errorf("unexpected result: %v, expected: %v", files, expected)
+	}
+
+	_, err = findRotated(filepath.Join(dir, "none.log"))
+	if err == nil {
+		t.Error("expected error for an empty set")
+	}
+}
+
+func TestRotatedReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hlogf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var names []string
+	for i, data := range []string{"a\nb", "", "c\n"} {
+		name := filepath.Join(dir, string(rune('0'+i)))
+		err := ioutil.WriteFile(name, []byte(data), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+
+	r := &rotatedReader{names: names}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a\nb\nc\n" {
+		t.Errorf("unexpected result: %q", data)
+	}
+}
@@ -2,15 +2,14 @@ package main
 
 import (
 	"bufio"
-	"fmt"
+	"bytes"
 	"io"
-	"os"
+	"regexp"
 	"runtime"
 	"strconv"
 	"sync"
 
 	"github.com/ssgreg/logf"
-	"github.com/ssgreg/logftext"
 )
 
 // Options holds scan options.
@@ -20,18 +19,26 @@ type Options struct {
 	NumberLines    bool
 	StartingNumber int
 	TimeFormat     string
+	Filters        Filters
+	Grep           *grepFilter
+	TimeRange      *timeRange
+	Mapping        *fieldMapping
+	Prefix         *regexp.Regexp
+	Fields         *fieldSelector
+	FlattenDepth   int
+	Expand         expandPolicy
+	SourceWidth    int
+	Theme          *theme
+	Output         outputFormat
 }
 
 type shot struct {
 	exist  bool
 	number int
 	buf    *logf.Buffer
+	span   span
 }
 
-var cnt = uint32(0)
-var cntput = uint32(0)
-var cntget = uint32(0)
-
 const (
 	ringBufferCapacity     = 1024
 	writerChannelCapacity  = 128
@@ -75,7 +82,9 @@ func (b *ringBuffer) get() (shot, bool) {
 }
 
 func makeWorker(w io.Writer, p Pool, opts Options) (chan shot, *sync.WaitGroup) {
-	rb := &ringBuffer{}
+	// Shots are numbered by lines starting at 1 and continue numbers of
+	// the previous scan.
+	rb := &ringBuffer{index: opts.StartingNumber}
 
 	slowBuf := make(map[int]shot)
 
@@ -98,6 +107,42 @@ func makeWorker(w io.Writer, p Pool, opts Options) (chan shot, *sync.WaitGroup)
 			number[i] = ' '
 		}
 
+		// Entries without time are shown only inside an open time range
+		// if the corresponding policy is set.
+		trackRange := opts.TimeRange != nil && opts.TimeRange.policy == untimedInside
+		rangeOpen := false
+
+		write := func(s shot) {
+			if trackRange {
+				switch s.span {
+				case spanInside:
+					rangeOpen = true
+				case spanOutside:
+					rangeOpen = false
+				case spanUnknown:
+					if !rangeOpen && s.buf != nil {
+						p.Put(s.buf)
+						s.buf = nil
+					}
+				}
+			}
+
+			if s.buf == nil {
+				// The entry was filtered out.
+				return
+			}
+
+			if opts.NumberLines {
+				onlyNumber := strconv.AppendInt(number[numberStart:numberStart:len(number)], int64(s.number), 10)
+				window := ((len(onlyNumber)-1)/numberStart + 1) * numberStart
+				padding := numberStart + len(onlyNumber) - window
+				bw.Write(number[padding : padding+window+1])
+			}
+
+			bw.Write(s.buf.Bytes())
+			p.Put(s.buf)
+		}
+
 		for {
 			select {
 			case data, ok = <-ch:
@@ -110,15 +155,7 @@ func makeWorker(w io.Writer, p Pool, opts Options) (chan shot, *sync.WaitGroup)
 						if !okg {
 							break
 						}
-						if opts.NumberLines {
-							onlyNumber := strconv.AppendInt(number[numberStart:numberStart:len(number)], int64(s.number), 10)
-							window := ((len(onlyNumber)-1)/numberStart + 1) * numberStart
-							padding := numberStart + len(onlyNumber) - window
-							bw.Write(number[padding : padding+window+1])
-						}
-
-						bw.Write(s.buf.Bytes())
-						p.Put(s.buf)
+						write(s)
 					}
 
 					return
@@ -143,15 +180,7 @@ func makeWorker(w io.Writer, p Pool, opts Options) (chan shot, *sync.WaitGroup)
 						break
 					}
 
-					if opts.NumberLines {
-						onlyNumber := strconv.AppendInt(number[numberStart:numberStart:len(number)], int64(s.number), 10)
-						window := ((len(onlyNumber)-1)/numberStart + 1) * numberStart
-						padding := numberStart + len(onlyNumber) - window
-						bw.Write(number[padding : padding+window+1])
-					}
-
-					bw.Write(s.buf.Bytes())
-					p.Put(s.buf)
+					write(s)
 				}
 			}
 		}
@@ -163,40 +192,106 @@ func makeWorker(w io.Writer, p Pool, opts Options) (chan shot, *sync.WaitGroup)
 type scanEntry struct {
 	number int
 	data   []byte
+
+	// Label of the input the line came from, if any.
+	source []byte
 }
 
 func makeFormatter(us chan scanEntry, ds chan shot, p Pool, opts Options) *sync.WaitGroup {
-	eseq := logftext.EscapeSequence{NoColor: opts.NoColor}
+	f := newFormatter(opts)
 
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 
+		// The entry is reused to avoid allocation of fields.
+		var e Entry
+
 		for se := range us {
-			buf := p.Get() // logf.NewBufferWithCapacity(1024) //p.Get()
-			// buf.AppendBytes(se.data)
-			// buf.AppendByte('\n')
-
-			e, ok := parse(se.data)
-			if !ok {
-				buf.AppendBytes(se.data)
-				buf.AppendByte('\n')
+			// The buffer stays nil if the entry is filtered out.
+			var buf *logf.Buffer
+			sp := spanInside
+
+			if !parseEntry(se.data, opts, &e) {
+				if opts.TimeRange != nil {
+					sp = spanUnknown
+				}
+				if opts.Filters.MatchRaw(se.data) && keepSpan(sp, opts.TimeRange) {
+					buf = p.Get()
+					f.formatRaw(buf, se.data, se.source)
+				}
 			} else {
-				adoptEntry(&e)
-				format(buf, eseq, &e, opts.TimeFormat)
+				if len(se.source) != 0 {
+					e.Source = se.source
+				}
+				if opts.TimeRange != nil {
+					sp = opts.TimeRange.check(&e)
+				}
+				if keepSpan(sp, opts.TimeRange) && opts.Filters.Match(&e) {
+					buf = p.Get()
+					f.format(buf, &e)
+				}
 			}
 
-			// p.Put(buf)
-			ds <- shot{true, se.number - 1, buf}
+			ds <- shot{true, se.number, buf, sp}
 		}
 	}()
 
 	return &wg
 }
 
+// parseEntry resets the entry and parses the line to it using the prefix
+// and the mapping of the options. The parsed entry is adopted.
+func parseEntry(data []byte, opts Options, e *Entry) bool {
+	e.reset()
+	ok := false
+	if opts.Prefix != nil {
+		ok = parseUserPrefix(data, opts.Prefix, opts.Mapping, e)
+		if !ok {
+			e.reset()
+		}
+	}
+	if !ok {
+		ok = parse(data, opts.Mapping, e)
+	}
+	if ok {
+		adoptEntry(e)
+	}
+
+	return ok
+}
+
+// keepSpan checks whether an entry with the given span could be shown.
+// Entries without time are finally checked by the writer in case of
+// untimedInside policy.
+func keepSpan(sp span, r *timeRange) bool {
+	switch sp {
+	case spanOutside:
+		return false
+	case spanUnknown:
+		return r.policy != untimedDrop
+	}
+
+	return true
+}
+
+// scan reads lines of r and writes formatted entries to w. It returns the
+// number of the next line.
 func scan(r io.Reader, w io.Writer, opts Options) (int, error) {
-	scanBuf := make([]byte, opts.BufferSize)
+	return process(w, opts, func(send func(data, source []byte)) error {
+		return scanLines(r, make([]byte, opts.BufferSize), func(data []byte) {
+			send(data, nil)
+		})
+	})
+}
+
+// process formats lines produced by read in parallel and writes them to w
+// in the original order. It returns the number of the next line.
+func process(w io.Writer, opts Options, read func(send func(data, source []byte)) error) (int, error) {
+	if opts.Mapping == nil {
+		opts.Mapping = defaultFieldMapping
+	}
 
 	usCh := make(chan scanEntry, scannerChannelCapacity)
 
@@ -218,29 +313,40 @@ func scan(r io.Reader, w io.Writer, opts Options) (int, error) {
 		}
 	}()
 
+	err := read(func(data, source []byte) {
+		usCh <- scanEntry{number: opts.StartingNumber, data: data, source: source}
+		opts.StartingNumber++
+	})
+
+	return opts.StartingNumber, err
+}
+
+// scanLines reads lines of r using the given buffer and passes them to
+// emit. Partial lines of CRI container logs are joined.
+func scanLines(r io.Reader, scanBuf []byte, emit func([]byte)) error {
+	// Partial lines of CRI container logs are joined before they are
+	// parsed in parallel.
+	var cri criJoiner
+
 	lastLineWasTooLong := false
 	for {
 		scanner := bufio.NewScanner(r)
 		scanner.Buffer(scanBuf, len(scanBuf))
 
 		for scanner.Scan() {
-			se := scanEntry{number: opts.StartingNumber}
-			opts.StartingNumber++
-
 			if lastLineWasTooLong {
 				lastLineWasTooLong = false
-				se.data = []byte("<line too long>\n")
+				cri.add([]byte("<line too long>\n"), emit)
 			} else {
-				se.data = scanner.Bytes()
+				cri.add(scanner.Bytes(), emit)
 			}
-
-			usCh <- se
 		}
 
 		switch scanner.Err() {
 		case nil:
-			fmt.Fprintln(os.Stderr, "----------------------------", cnt, cntget, cntput, opts.StartingNumber)
-			return opts.StartingNumber, nil
+			cri.flush(emit)
+
+			return nil
 
 		case bufio.ErrTooLong:
 			// Data does not match to the buffer. As scanner drops the read
@@ -249,7 +355,7 @@ func scan(r io.Reader, w io.Writer, opts Options) (int, error) {
 			lastLineWasTooLong = true
 
 		default:
-			return opts.StartingNumber, scanner.Err()
+			return scanner.Err()
 		}
 	}
 }
@@ -269,68 +375,128 @@ type Entry struct {
 	Name     []byte
 	Caller   []byte
 	Priority []byte
-	Fields   [10]Field
+	Fields   []Field
+
+	// Source is a label of the source of the entry, e.g. a prefix of
+	// the line added by kubectl or docker compose.
+	Source []byte
+
+	Severity Severity
+
+	// arena holds values that are not slices of the parsed line, e.g.
+	// quoted values of logfmt lines.
+	arena []byte
+}
+
+// reset clears the entry. Memory allocated for fields is kept to be
+// reused by the next entry.
+func (e *Entry) reset() {
+	*e = Entry{Fields: e.Fields[:0], arena: e.arena[:0]}
+}
+
+// parse parses a JSON object or a logfmt line to the given entry. Lines
+// wrapped into container log envelopes are unwrapped. Keys are mapped to
+// roles of the entry using the given mapping. The entry is expected to be
+// reset.
+func parse(data []byte, m *fieldMapping, t *Entry) bool {
+	if l, ok := parseCRILine(data); ok {
+		return parseCRI(l, m, t)
+	}
+	if bytes.HasPrefix(data, []byte(`{"log":`)) && parseDocker(data, m, t) {
+		return true
+	}
+
+	if parseLine(data, m, t) {
+		return true
+	}
+	t.reset()
+
+	return parsePrefixed(data, m, t)
 }
 
-func parse(data []byte) (Entry, bool) {
-	var t Entry
+// parseLine parses a JSON object or a logfmt line to the given entry.
+func parseLine(data []byte, m *fieldMapping, t *Entry) bool {
+	if len(data) != 0 && data[0] == '{' {
+		return parseJSON(data, m, t)
+	}
+
+	return parseLogfmt(data, m, t)
+}
+
+// parseJSON parses a JSON object to the given entry.
+func parseJSON(data []byte, m *fieldMapping, t *Entry) bool {
 	if len(data) < 2 {
-		return t, false
+		return false
 	}
 	if data[0] != '{' || data[len(data)-1] != '}' {
-		return t, false
+		return false
 	}
 	data = data[1 : len(data)-1]
 
-	fieldCount := 0
-
+	var rs roleState
 	for idx := 0; idx < len(data); {
 		key, length, ok := fetchKey(data[idx:])
 		if !ok {
-			return t, false
+			return false
 		}
 		idx += length + 1
 
 		val, length, ok := fetchValue(data[idx:])
 		if !ok {
-			return t, false
+			return false
 		}
 		idx += length + 1
 
-		switch string(key) {
-		case "level", "LEVEL":
-			if len(t.Level) == 0 {
-				t.Level = val
-			} else {
-				if key[0] != '_' {
-					// t.Fields = append(t.Fields, Field{key, val})
-					t.Fields[fieldCount] = Field{key, val}
-					fieldCount++
-				}
-			}
-		case "ts", "TS", "time", "TIME":
-			t.Time = val
-		case "_SOURCE_REALTIME_TIMESTAMP":
-			t.RealtimeTimestamp = val
-		case "__REALTIME_TIMESTAMP":
-			t.SourceTimestamp = val
-		case "msg", "MESSAGE":
-			t.Msg = val
-		case "logger", "LOGGER":
-			t.Name = val
-		case "caller", "CALLER":
-			t.Caller = val
-		case "PRIORITY":
-			t.Priority = val
-		case "SYSLOG_FACILITY", "SYSLOG_IDENTIFIER":
-		default:
-			if key[0] != '_' {
-				// t.Fields = append(t.Fields, Field{key, val})
-				t.Fields[fieldCount] = Field{key, val}
-				fieldCount++
-			}
+		t.set(m, &rs, key, val)
+	}
+
+	return true
+}
+
+// roleState holds keys and priorities of values already assigned to roles
+// of an entry.
+type roleState struct {
+	keys       [roleCount][]byte
+	priorities [roleCount]int
+}
+
+// set sets the value with the given key to the mapped role of the entry or
+// adds it to the fields. Values are in JSON form.
+func (t *Entry) set(m *fieldMapping, rs *roleState, key, val []byte) {
+	addField := func(key, val []byte) {
+		if m.showField(key) {
+			t.Fields = append(t.Fields, Field{key, val})
 		}
 	}
 
-	return t, true
+	switch string(key) {
+	case "_SOURCE_REALTIME_TIMESTAMP":
+		t.SourceTimestamp = val
+	case "__REALTIME_TIMESTAMP":
+		t.RealtimeTimestamp = val
+	case "PRIORITY":
+		t.Priority = val
+	default:
+		mr, ok := m.keys[string(key)]
+		if !ok {
+			addField(key, val)
+
+			break
+		}
+
+		v := t.role(mr.role)
+		switch {
+		case len(rs.keys[mr.role]) == 0:
+		case mr.priority < rs.priorities[mr.role]:
+			// The key has higher priority than the assigned one.
+			addField(rs.keys[mr.role], *v)
+		default:
+			addField(key, val)
+
+			return
+		}
+		*v = val
+		rs.keys[mr.role] = key
+		rs.priorities[mr.role] = mr.priority
+	}
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseManyFields(t *testing.T) {
+	var fields []string
+	for i := 0; i < 50; i++ {
+		fields = append(fields, fmt.Sprintf(`"key%d":%d`, i, i))
+	}
+	data := []byte(`{"msg":"many",` + strings.Join(fields, ",") + `}`)
+
+	var e Entry
+	if !parse(data, defaultFieldMapping, &e) {
+		t.Fatal("failed to parse entry")
+	}
+	if len(e.Fields) != 50 {
+		t.Fatalf("expected 50 fields, got %d", len(e.Fields))
+	}
+	for i, f := range e.Fields {
+		if string(f.Key) != fmt.Sprintf("key%d", i) {
+			t.Errorf("field %d: unexpected key %s", i, f.Key)
+		}
+	}
+
+	// Memory of fields is reused.
+	e.reset()
+	if !parse([]byte(`{"a":1}`), defaultFieldMapping, &e) || len(e.Fields) != 1 || cap(e.Fields) < 50 {
+		t.Errorf("fields are not reused: len %d, cap %d", len(e.Fields), cap(e.Fields))
+	}
+}
+
+func TestParseMapping(t *testing.T) {
+	m, err := parseFieldMapping([]string{"msg=message", "msg=text", "time=@timestamp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var e Entry
+	if !parse([]byte(`{"text":"t","msg":"m","message":"x","@timestamp":"1"}`), m, &e) {
+		t.Fatal("failed to parse entry")
+	}
+	if string(e.Msg) != `"x"` || string(e.Time) != `"1"` {
+		t.Errorf("unexpected msg %s or time %s", e.Msg, e.Time)
+	}
+
+	var keys []string
+	for _, f := range e.Fields {
+		keys = append(keys, string(f.Key))
+	}
+	if strings.Join(keys, ",") != "msg,text" {
+		t.Errorf("unexpected fields %v", keys)
+	}
+}
+
+func TestParseLogfmt(t *testing.T) {
+	var e Entry
+	data := []byte(`ts=2024-01-01T10:00:00Z level=warn msg="request \"done\"" status=200 path=/a\b ok=true empty= neg=-1.5e3`)
+	if !parse(data, defaultFieldMapping, &e) {
+		t.Fatal("failed to parse entry")
+	}
+	if string(e.Time) != `"2024-01-01T10:00:00Z"` || string(e.Level) != `"warn"` || string(e.Msg) != `"request \"done\""` {
+		t.Errorf("unexpected roles: %s %s %s", e.Time, e.Level, e.Msg)
+	}
+
+	var fields []string
+	for _, f := range e.Fields {
+		fields = append(fields, string(f.Key)+"="+string(f.Value))
+	}
+	expected := `status=200 path="/a\\b" ok=true empty="" neg=-1.5e3`
+	if r := strings.Join(fields, " "); r != expected {
+		t.Errorf("expected %s, got %s", expected, r)
+	}
+
+	for _, line := range []string{"plain text", "a=1 b=2", `msg="unterminated`, `msg="a"b`, ""} {
+		e.reset()
+		if parse([]byte(line), defaultFieldMapping, &e) {
+			t.Errorf("%q: expected not to be parsed", line)
+		}
+	}
+}
+
+func TestScanStartingNumber(t *testing.T) {
+	var b bytes.Buffer
+	opts := Options{NoColor: true, Output: outputJSON, StartingNumber: 1, BufferSize: 4096}
+
+	next, err := scan(strings.NewReader("{\"msg\":\"a\"}\n"), &b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != 2 {
+		t.Errorf("unexpected next number: %d", next)
+	}
+
+	// Lines of the second scan are written although their numbers don't
+	// start from the beginning.
+	opts.StartingNumber = next
+	_, err = scan(strings.NewReader("{\"msg\":\"b\"}\n"), &b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "{\"msg\":\"a\"}\n{\"msg\":\"b\"}\n"
+	if b.String() != expected {
+		t.Errorf("unexpected result: %q", b.String())
+	}
+}
+
+func TestScanNumberLines(t *testing.T) {
+	var b bytes.Buffer
+	opts := Options{NoColor: true, Output: outputJSON, NumberLines: true, StartingNumber: 1, BufferSize: 4096}
+
+	next, err := scan(strings.NewReader("{\"msg\":\"a\"}\nb\n"), &b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.StartingNumber = next
+	_, err = scan(strings.NewReader("{\"msg\":\"c\"}\n"), &b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Numbers start at 1 and continue in the next scan.
+	expected := "       1 {\"msg\":\"a\"}\n       2 {\"msg\":\"b\"}\n       3 {\"msg\":\"c\"}\n"
+	if b.String() != expected {
+		t.Errorf("unexpected result: %q", b.String())
+	}
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ssgreg/logf"
+)
+
+// style is a precompiled escape sequence that sets colors and attributes
+// of the text. An empty style does not change the text.
+type style string
+
+// at calls the given fn, wrapped with the style.
+func (s style) at(buf *logf.Buffer, fn func()) {
+	if s == "" {
+		fn()
+
+		return
+	}
+
+	buf.AppendString(string(s))
+	fn()
+	buf.AppendString(escReset)
+}
+
+const escReset = "\x1b[0m"
+
+// theme holds styles of all parts of a formatted entry.
+type theme struct {
+	Time      style
+	Levels    [SeverityPanic + 1]style
+	Logger    style
+	Message   style
+	Key       style
+	Separator style
+	Value     style
+	Caller    style
+	Highlight style
+
+	// Error messages and frames of stack traces.
+	Error         style
+	StackFunction style
+	StackLocation style
+
+	// Source labels are colored with one of the styles selected by the
+	// label value.
+	Sources []style
+}
+
+// themeSpec describes a theme as a set of style specifications, e.g.
+// "bold bright-red", "bg:red white", "#e69f00", "208" or "reverse". The
+// "source" key holds a list of styles separated with '|'.
+type themeSpec map[string]string
+
+// Keys of theme specifications.
+var themeKeys = []string{
+	"time", "logger", "message", "key", "separator", "value", "caller", "highlight",
+	"error", "stack-function", "stack-location", "source",
+	"level-unknown", "level-trace", "level-debug", "level-info", "level-notice",
+	"level-warn", "level-error", "level-critical", "level-fatal", "level-panic",
+}
+
+// Built-in themes.
+var themes = map[string]themeSpec{
+	// The default theme for dark terminals.
+	"dark": {
+		"time":           "bright-black",
+		"logger":         "bright-black",
+		"message":        "bright-white",
+		"key":            "green",
+		"separator":      "bright-black",
+		"caller":         "bright-black",
+		"highlight":      "bold reverse",
+		"error":          "bold bright-red",
+		"stack-function": "dim",
+		"stack-location": "bright-yellow",
+		"source":         "cyan | magenta | yellow | blue | bright-green | bright-cyan | bright-magenta | bright-blue",
+		"level-unknown":  "bright-red",
+		"level-trace":    "magenta",
+		"level-debug":    "magenta",
+		"level-info":     "cyan",
+		"level-notice":   "bright-cyan",
+		"level-warn":     "bright-yellow reverse",
+		"level-error":    "bright-red reverse",
+		"level-critical": "bright-white bg:red",
+		"level-fatal":    "bright-white bg:red",
+		"level-panic":    "bright-white bg:red",
+	},
+	// The theme for light terminals. Bright colors are hard to read on
+	// a light background.
+	"light": {
+		"time":           "bright-black",
+		"logger":         "bright-black",
+		"message":        "black",
+		"key":            "blue",
+		"separator":      "bright-black",
+		"caller":         "bright-black",
+		"highlight":      "bold reverse",
+		"error":          "bold red",
+		"stack-function": "dim",
+		"stack-location": "blue",
+		"source":         "blue | magenta | cyan | green | yellow | red",
+		"level-unknown":  "red",
+		"level-trace":    "magenta",
+		"level-debug":    "magenta",
+		"level-info":     "blue",
+		"level-notice":   "cyan",
+		"level-warn":     "yellow reverse",
+		"level-error":    "red reverse",
+		"level-critical": "white bg:red",
+		"level-fatal":    "white bg:red",
+		"level-panic":    "white bg:red",
+	},
+	// The theme that doesn't rely on red-green distinction. Colors are
+	// taken from the Okabe-Ito palette.
+	"colorblind": {
+		"time":           "bright-black",
+		"logger":         "bright-black",
+		"message":        "bold",
+		"key":            "#56b4e9",
+		"separator":      "bright-black",
+		"caller":         "bright-black",
+		"highlight":      "bold underline",
+		"error":          "bold #d55e00",
+		"stack-function": "dim",
+		"stack-location": "#e69f00",
+		"source":         "#e69f00 | #56b4e9 | #009e73 | #f0e442 | #0072b2 | #d55e00 | #cc79a7",
+		"level-unknown":  "#cc79a7",
+		"level-trace":    "#999999",
+		"level-debug":    "#cc79a7",
+		"level-info":     "#0072b2",
+		"level-notice":   "#56b4e9",
+		"level-warn":     "#e69f00 reverse",
+		"level-error":    "bold #d55e00 reverse",
+		"level-critical": "bold #f0e442 bg:#0072b2",
+		"level-fatal":    "bold #f0e442 bg:#0072b2",
+		"level-panic":    "bold #f0e442 bg:#0072b2",
+	},
+}
+
+// colorDepth is a number of colors a terminal supports.
+type colorDepth int
+
+const (
+	colorDepth16        colorDepth = 16
+	colorDepth256       colorDepth = 256
+	colorDepthTrueColor colorDepth = 1 << 24
+)
+
+// detectColorDepth detects a number of colors of the terminal by
+// COLORTERM and TERM environment variables.
+func detectColorDepth() colorDepth {
+	switch strings.ToLower(os.Getenv("COLORTERM")) {
+	case "truecolor", "24bit":
+		return colorDepthTrueColor
+	}
+	if strings.Contains(os.Getenv("TERM"), "256color") {
+		return colorDepth256
+	}
+
+	return colorDepth16
+}
+
+// detectLightTerminal checks whether the terminal has a light background
+// by COLORFGBG environment variable, e.g. "0;15".
+func detectLightTerminal() bool {
+	v := os.Getenv("COLORFGBG")
+	bg := v[strings.LastIndexByte(v, ';')+1:]
+
+	return bg == "7" || bg == "15"
+}
+
+// newTheme compiles a theme. Custom themes override the built-in ones.
+// Name "auto" selects "dark" or "light" theme based on the terminal.
+func newTheme(name string, custom map[string]themeSpec, depth colorDepth) (*theme, error) {
+	if name == "auto" {
+		name = "dark"
+		if detectLightTerminal() {
+			name = "light"
+		}
+	}
+
+	spec, err := resolveThemeSpec(name, custom, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var t theme
+	for key, value := range spec {
+		if key == "source" {
+			// A list of styles separated with '|'.
+			for _, v := range strings.Split(value, "|") {
+				s, err := compileStyle(v, depth)
+				if err != nil {
+					return nil, fmt.Errorf("theme %q: %q: %s", name, key, err)
+				}
+				if s != "" {
+					t.Sources = append(t.Sources, s)
+				}
+			}
+
+			continue
+		}
+
+		s, err := compileStyle(value, depth)
+		if err != nil {
+			return nil, fmt.Errorf("theme %q: %q: %s", name, key, err)
+		}
+
+		switch key {
+		case "time":
+			t.Time = s
+		case "logger":
+			t.Logger = s
+		case "message":
+			t.Message = s
+		case "key":
+			t.Key = s
+		case "separator":
+			t.Separator = s
+		case "value":
+			t.Value = s
+		case "caller":
+			t.Caller = s
+		case "highlight":
+			t.Highlight = s
+		case "error":
+			t.Error = s
+		case "stack-function":
+			t.StackFunction = s
+		case "stack-location":
+			t.StackLocation = s
+		default:
+			severity, ok := severityNames[strings.TrimPrefix(key, "level-")]
+			if !strings.HasPrefix(key, "level-") || !ok && key != "level-unknown" {
+				return nil, fmt.Errorf("theme %q: unknown key %q, expected one of %s", name, key, strings.Join(themeKeys, ", "))
+			}
+			t.Levels[severity] = s
+		}
+	}
+
+	return &t, nil
+}
+
+// resolveThemeSpec returns a full specification of the named theme.
+// Custom themes can inherit other themes with the "inherit" key.
+func resolveThemeSpec(name string, custom map[string]themeSpec, depth int) (themeSpec, error) {
+	if depth > 8 {
+		return nil, fmt.Errorf("theme %q: too deep inheritance", name)
+	}
+
+	spec, ok := custom[name]
+	if !ok {
+		spec, ok = themes[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown theme %q, expected one of %s", name, strings.Join(themeNames(custom), ", "))
+		}
+
+		return spec, nil
+	}
+
+	base := themeSpec{}
+	if parent, ok := spec["inherit"]; ok {
+		var err error
+		base, err = resolveThemeSpec(parent, custom, depth+1)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r := make(themeSpec, len(base)+len(spec))
+	for k, v := range base {
+		r[k] = v
+	}
+	for k, v := range spec {
+		if k != "inherit" {
+			r[k] = v
+		}
+	}
+
+	return r, nil
+}
+
+func themeNames(custom map[string]themeSpec) []string {
+	names := []string{"auto"}
+	for name := range themes {
+		names = append(names, name)
+	}
+	for name := range custom {
+		if _, ok := themes[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+
+	return names
+}
+
+// Names of the basic 16 colors in the order of their codes.
+var colorNames = []string{
+	"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white",
+	"bright-black", "bright-red", "bright-green", "bright-yellow",
+	"bright-blue", "bright-magenta", "bright-cyan", "bright-white",
+}
+
+// Approximate RGB values of the basic 16 colors, as in xterm.
+var colorRGB = [16][3]uint8{
+	{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0},
+	{0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+	{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0},
+	{92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+}
+
+var attributeCodes = map[string]string{
+	"bold":      "1",
+	"faint":     "2",
+	"dim":       "2",
+	"italic":    "3",
+	"underline": "4",
+	"blink":     "5",
+	"reverse":   "7",
+}
+
+// compileStyle compiles a style specification to an escape sequence. Colors
+// not supported by the terminal are replaced with the nearest ones.
+func compileStyle(spec string, depth colorDepth) (style, error) {
+	var codes []string
+
+	for _, word := range strings.FieldsFunc(spec, func(r rune) bool { return r == ' ' || r == '+' || r == ',' }) {
+		word = strings.ToLower(word)
+
+		if code, ok := attributeCodes[word]; ok {
+			codes = append(codes, code)
+
+			continue
+		}
+		if word == "none" || word == "default" {
+			continue
+		}
+
+		bg := strings.HasPrefix(word, "bg:")
+		code, err := colorCode(strings.TrimPrefix(word, "bg:"), bg, depth)
+		if err != nil {
+			return "", err
+		}
+		codes = append(codes, code)
+	}
+
+	if len(codes) == 0 {
+		return "", nil
+	}
+
+	return style("\x1b[" + strings.Join(codes, ";") + "m"), nil
+}
+
+// colorCode returns a code of the named, 256-palette ("0"-"255") or RGB
+// ("#rrggbb") color.
+func colorCode(color string, bg bool, depth colorDepth) (string, error) {
+	for i, name := range colorNames {
+		if name == color || (i == 8 && (color == "gray" || color == "grey")) {
+			return basicColorCode(i, bg), nil
+		}
+	}
+
+	prefix := "38"
+	if bg {
+		prefix = "48"
+	}
+
+	if strings.HasPrefix(color, "#") && len(color) == 7 {
+		v, err := strconv.ParseUint(color[1:], 16, 32)
+		if err != nil {
+			return "", fmt.Errorf("bad color %q", color)
+		}
+		rgb := [3]uint8{uint8(v >> 16), uint8(v >> 8), uint8(v)}
+
+		switch depth {
+		case colorDepthTrueColor:
+			return fmt.Sprintf("%s;2;%d;%d;%d", prefix, rgb[0], rgb[1], rgb[2]), nil
+		case colorDepth256:
+			return fmt.Sprintf("%s;5;%d", prefix, rgbToPalette(rgb)), nil
+		default:
+			return basicColorCode(nearestBasicColor(rgb), bg), nil
+		}
+	}
+
+	if n, err := strconv.ParseUint(color, 10, 8); err == nil {
+		if depth == colorDepth16 {
+			return basicColorCode(nearestBasicColor(paletteToRGB(uint8(n))), bg), nil
+		}
+
+		return fmt.Sprintf("%s;5;%d", prefix, n), nil
+	}
+
+	return "", fmt.Errorf("bad color %q, expected one of %s, 0-255, #rrggbb or an attribute", color, strings.Join(colorNames, ", "))
+}
+
+func basicColorCode(i int, bg bool) string {
+	code := 30 + i
+	if i >= 8 {
+		code = 90 + i - 8
+	}
+	if bg {
+		code += 10
+	}
+
+	return strconv.Itoa(code)
+}
+
+// Levels of each component of the 6x6x6 color cube of the 256-palette.
+var paletteCubeLevels = [6]uint8{0, 95, 135, 175, 215, 255}
+
+// paletteToRGB returns an RGB value of the 256-palette color.
+func paletteToRGB(n uint8) [3]uint8 {
+	switch {
+	case n < 16:
+		return colorRGB[n]
+	case n < 232:
+		n -= 16
+
+		return [3]uint8{paletteCubeLevels[n/36], paletteCubeLevels[n/6%6], paletteCubeLevels[n%6]}
+	default:
+		v := 8 + (n-232)*10
+
+		return [3]uint8{v, v, v}
+	}
+}
+
+// rgbToPalette returns the nearest 256-palette color.
+func rgbToPalette(rgb [3]uint8) uint8 {
+	cube := func(v uint8) uint8 {
+		switch {
+		case v < 48:
+			return 0
+		case v < 115:
+			return 1
+		default:
+			return (v - 35) / 40
+		}
+	}
+
+	n := 16 + 36*cube(rgb[0]) + 6*cube(rgb[1]) + cube(rgb[2])
+
+	// The grayscale ramp could be closer.
+	avg := (int(rgb[0]) + int(rgb[1]) + int(rgb[2])) / 3
+	gray := uint8(232)
+	if avg > 8 {
+		step := (avg - 8) / 10
+		if step > 23 {
+			step = 23
+		}
+		gray += uint8(step)
+	}
+	if colorDistance(paletteToRGB(gray), rgb) < colorDistance(paletteToRGB(n), rgb) {
+		return gray
+	}
+
+	return n
+}
+
+// nearestBasicColor returns an index of the nearest basic color.
+func nearestBasicColor(rgb [3]uint8) int {
+	r := 0
+	for i := range colorRGB {
+		if colorDistance(colorRGB[i], rgb) < colorDistance(colorRGB[r], rgb) {
+			r = i
+		}
+	}
+
+	return r
+}
+
+func colorDistance(a, b [3]uint8) int {
+	d := 0
+	for i := range a {
+		x := int(a[i]) - int(b[i])
+		d += x * x
+	}
+
+	return d
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCompileStyle(t *testing.T) {
+	cases := []struct {
+		spec     string
+		depth    colorDepth
+		expected style
+	}{
+		{"", colorDepth16, ""},
+		{"none", colorDepth16, ""},
+		{"bright-black", colorDepth16, "\x1b[90m"},
+		{"bright-yellow reverse", colorDepth16, "\x1b[93;7m"},
+		{"bold+bg:red", colorDepth16, "\x1b[1;41m"},
+		{"#e69f00", colorDepthTrueColor, "\x1b[38;2;230;159;0m"},
+		{"#e69f00", colorDepth256, "\x1b[38;5;178m"},
+		{"#e69f00", colorDepth16, "\x1b[33m"},
+		{"bg:208", colorDepth256, "\x1b[48;5;208m"},
+		{"196", colorDepth16, "\x1b[91m"},
+		{"#808080", colorDepth256, "\x1b[38;5;244m"},
+	}
+
+	for _, c := range cases {
+		s, err := compileStyle(c.spec, c.depth)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", c.spec, err)
+
+			continue
+		}
+		if s != c.expected {
+			t.Errorf("%q (%d colors): expected %q, got %q", c.spec, c.depth, c.expected, s)
+		}
+	}
+
+	for _, spec := range []string{"purple", "#12345", "256", "bg:"} {
+		if _, err := compileStyle(spec, colorDepthTrueColor); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestThemes(t *testing.T) {
+	custom := map[string]themeSpec{
+		"mine":  {"inherit": "light", "key": "208"},
+		"loop":  {"inherit": "loop"},
+		"wrong": {"level-verbose": "red"},
+	}
+
+	for _, name := range []string{"dark", "light", "colorblind", "mine"} {
+		th, err := newTheme(name, custom, colorDepth256)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+
+			continue
+		}
+		for s, st := range th.Levels {
+			if st == "" {
+				t.Errorf("%s: no style for level %v", name, Severity(s))
+			}
+		}
+	}
+
+	for _, name := range []string{"loop", "wrong", "unknown"} {
+		if _, err := newTheme(name, custom, colorDepth256); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
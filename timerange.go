@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// span describes the position of an entry relative to a time range.
+type span int8
+
+const (
+	spanInside span = iota
+	spanOutside
+	spanUnknown
+)
+
+// untimedPolicy defines what to do with entries without a parseable time
+// when a time range is specified.
+type untimedPolicy int8
+
+const (
+	// Show entries without time only if the last entry with time is in
+	// the range. E.g. a stack trace printed after an entry is shown only
+	// along with the entry.
+	untimedInside untimedPolicy = iota
+	untimedKeep
+	untimedDrop
+)
+
+func parseUntimedPolicy(s string) (untimedPolicy, error) {
+	switch strings.ToLower(s) {
+	case "inside":
+		return untimedInside, nil
+	case "keep":
+		return untimedKeep, nil
+	case "drop":
+		return untimedDrop, nil
+	}
+
+	return untimedInside, fmt.Errorf("unknown untimed entries policy %q, expected one of inside, keep, drop", s)
+}
+
+// timeRange selects entries with time in [since, until). Zero since or
+// until means the range is not limited from the corresponding side.
+type timeRange struct {
+	since  time.Time
+	until  time.Time
+	policy untimedPolicy
+}
+
+// check returns the position of the entry relative to the range.
+func (r *timeRange) check(e *Entry) span {
+	t, ok := encodeTime(e.Time)
+	if !ok {
+		return spanUnknown
+	}
+
+	if !r.since.IsZero() && t.Before(r.since) {
+		return spanOutside
+	}
+	if !r.until.IsZero() && !t.Before(r.until) {
+		return spanOutside
+	}
+
+	return spanInside
+}
+
+// Layouts of absolute times accepted by --since and --until. Times without
+// a time zone are in local time.
+var timeOptionLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// Layouts of times of day accepted by --since and --until.
+var timeOfDayOptionLayouts = []string{
+	"15:04:05.999999999",
+	"15:04",
+}
+
+// parseTimeOption parses a time specified by user. It can be an absolute
+// time, a time of day (today), a duration relative to now (e.g. "-15m"),
+// a unix timestamp or "now".
+func parseTimeOption(s string, now time.Time) (time.Time, error) {
+	if s == "now" {
+		return now, nil
+	}
+
+	if d, err := time.ParseDuration(strings.TrimPrefix(s, "-")); err == nil {
+		if s[0] == '+' {
+			return now.Add(d), nil
+		}
+
+		// Durations without sign point to the past as well.
+		return now.Add(-d), nil
+	}
+
+	if ts, ok := atoi(s); ok {
+		return parseTimeInt64(int64(ts)), nil
+	}
+
+	for _, layout := range timeOptionLayouts {
+		t, err := time.ParseInLocation(layout, s, now.Location())
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	for _, layout := range timeOfDayOptionLayouts {
+		t, err := time.ParseInLocation(layout, s, now.Location())
+		if err == nil {
+			y, m, d := now.Date()
+
+			return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), now.Location()), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("bad time %q, expected e.g. \"2006-01-02T15:04:05Z07:00\", \"2006-01-02 15:04\", \"15:04\" or \"-15m\"", s)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeOption(t *testing.T) {
+	loc := time.FixedZone("test", 3*60*60)
+	now := time.Date(2024, 1, 2, 15, 30, 0, 0, loc)
+
+	cases := []struct {
+		value    string
+		expected time.Time
+	}{
+		{"now", now},
+		{"-15m", now.Add(-15 * time.Minute)},
+		{"2h", now.Add(-2 * time.Hour)},
+		{"+1h", now.Add(time.Hour)},
+		{"14:05", time.Date(2024, 1, 2, 14, 5, 0, 0, loc)},
+		{"14:05:30.5", time.Date(2024, 1, 2, 14, 5, 30, 5e8, loc)},
+		{"2023-12-31", time.Date(2023, 12, 31, 0, 0, 0, 0, loc)},
+		{"2023-12-31 23:59", time.Date(2023, 12, 31, 23, 59, 0, 0, loc)},
+		{"2023-12-31T23:59:01Z", time.Date(2023, 12, 31, 23, 59, 1, 0, time.UTC)},
+		{"2023-12-31T23:59:01.25+01:00", time.Date(2023, 12, 31, 22, 59, 1, 25e7, time.UTC)},
+		{"1704067200", time.Unix(1704067200, 0)},
+	}
+
+	for _, c := range cases {
+		tm, err := parseTimeOption(c.value, now)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.value, err)
+
+			continue
+		}
+		if !tm.Equal(c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.value, c.expected, tm)
+		}
+	}
+
+	for _, value := range []string{"", "yesterday", "25:00", "2023-13-01"} {
+		if _, err := parseTimeOption(value, now); err == nil {
+			t.Errorf("%s: expected an error", value)
+		}
+	}
+}
+
+func TestTimeRangeCheck(t *testing.T) {
+	r := timeRange{
+		since: time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC),
+		until: time.Date(2024, 1, 1, 14, 10, 0, 0, time.UTC),
+	}
+
+	cases := []struct {
+		ts       string
+		expected span
+	}{
+		{`"2024-01-01T13:59:59.999Z"`, spanOutside},
+		{`"2024-01-01T14:00:00Z"`, spanInside},
+		{`"2024-01-01T14:09:59Z"`, spanInside},
+		{`"2024-01-01T14:10:00Z"`, spanOutside},
+		{`"not a time"`, spanUnknown},
+		{``, spanUnknown},
+	}
+
+	for _, c := range cases {
+		if sp := r.check(&Entry{Time: []byte(c.ts)}); sp != c.expected {
+			t.Errorf("%s: expected %v, got %v", c.ts, c.expected, sp)
+		}
+	}
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/ssgreg/logf"
+)
+
+// Stack traces and errors are printed as blocks after the entry line, one
+// frame per line. The following forms are recognized:
+//
+//   - Go stack traces, e.g. zap "stacktrace" field or panic output, with
+//     a function on one line and a tab-indented file:line on the next one;
+//   - Java stack traces with "at pkg.Class.method(File.java:10)" frames,
+//     as a string or as an array of frames;
+//   - Python tracebacks with `File "/a.py", line 3, in func` frames;
+//   - error objects shaped like {"type":..,"message":..,"stack":..} and
+//     arrays of them, e.g. Java exceptions with their causes.
+
+// Keys of fields that may contain stack traces, in lower case.
+var traceKeys = []string{
+	"stacktrace", "stack", "stack_trace", "traceback", "error", "err", "exception",
+}
+
+// Keys of fields with error messages, in lower case.
+var errorKeys = []string{
+	"error", "err", "exception",
+}
+
+// Keys of error objects and frame objects, in lower case.
+var (
+	errorMessageKeys = []string{"message", "msg"}
+	errorTypeKeys    = []string{"type", "kind", "class", "name", "exception_class"}
+	errorStackKeys   = []string{"stack", "stacktrace", "stack_trace", "extendedstacktrace", "traceback", "backtrace"}
+	errorCauseKeys   = []string{"cause", "caused_by"}
+	frameClassKeys   = []string{"class", "classname", "declaringclass", "module"}
+	frameMethodKeys  = []string{"method", "methodname", "function", "func"}
+	frameFileKeys    = []string{"file", "filename"}
+	frameLineKeys    = []string{"line", "linenumber", "lineno"}
+)
+
+// matchKey checks whether the key is one of the given lower case keys,
+// ignoring case.
+func matchKey(keys []string, key []byte) bool {
+	for _, k := range keys {
+		if len(k) != len(key) {
+			continue
+		}
+
+		i := 0
+		for i < len(k) {
+			c := key[i]
+			if 'A' <= c && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			if c != k[i] {
+				break
+			}
+			i++
+		}
+		if i == len(k) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isTrace checks whether the field is a stack trace or an error object
+// that should be printed as a block.
+func isTrace(field Field) bool {
+	val := field.Value
+	if len(val) == 0 {
+		return false
+	}
+
+	switch val[0] {
+	case '{':
+		_, ok := parseErrorObject(val)
+
+		return ok
+
+	case '[':
+		if matchKey(traceKeys, field.Key) {
+			return true
+		}
+		found := false
+		walkArray(val, func(v []byte) bool {
+			_, found = parseErrorObject(v)
+
+			return false
+		})
+
+		return found
+
+	case '"':
+		return matchKey(traceKeys, field.Key) && hasFrames(textValue(val))
+	}
+
+	return false
+}
+
+// hasFrames checks whether the text contains at least one frame.
+func hasFrames(text []byte) bool {
+	for len(text) != 0 {
+		var l traceLine
+		l, text = nextTraceLine(text, false)
+		if l.kind == traceFrame {
+			return true
+		}
+	}
+
+	return false
+}
+
+type traceLineKind int8
+
+const (
+	// Text that is not important, e.g. "Traceback (most recent call last):".
+	traceText traceLineKind = iota
+
+	// An error message, e.g. "java.lang.IllegalStateException: boom".
+	traceMessage
+
+	// A frame with function and location.
+	traceFrame
+)
+
+// traceLine is a parsed line of a stack trace. Location of a frame is
+// file or file:line if line is not empty. Extra is printed after the
+// location, e.g. Go program counter offset or Python source code.
+type traceLine struct {
+	kind  traceLineKind
+	text  []byte
+	fn    []byte
+	file  []byte
+	line  []byte
+	extra []byte
+}
+
+// nextTraceLine parses the next line of the text. Go and Python frames
+// take two lines. If bare is true, Java frames are recognized without the
+// "at " prefix. It returns the parsed line and the rest of the text.
+func nextTraceLine(text []byte, bare bool) (traceLine, []byte) {
+	line, rest := cutLine(text)
+	trimmed := bytes.TrimSpace(line)
+	l := traceLine{kind: traceMessage, text: trimmed}
+
+	switch {
+	case len(trimmed) == 0:
+		l.kind = traceText
+
+	// Java frame.
+	case bytes.HasSuffix(trimmed, []byte(")")) && (bare || bytes.HasPrefix(trimmed, []byte("at "))):
+		s := bytes.TrimPrefix(trimmed, []byte("at "))
+		i := bytes.LastIndexByte(s, '(')
+		if i <= 0 {
+			break
+		}
+		l.kind = traceFrame
+		l.fn = s[:i]
+		l.file = s[i+1 : len(s)-1]
+
+	// Python frame.
+	case bytes.HasPrefix(trimmed, []byte(`File "`)):
+		s := trimmed[len(`File "`):]
+		i := bytes.IndexByte(s, '"')
+		if i == -1 {
+			break
+		}
+		l.kind = traceFrame
+		l.file = s[:i]
+		s = s[i+1:]
+		if bytes.HasPrefix(s, []byte(", line ")) {
+			s = s[len(", line "):]
+			i = bytes.IndexByte(s, ',')
+			if i == -1 {
+				i = len(s)
+			}
+			l.line = s[:i]
+			s = s[i:]
+		}
+		if bytes.HasPrefix(s, []byte(", in ")) {
+			l.fn = s[len(", in "):]
+		}
+
+		// The source code line follows the frame.
+		next, after := cutLine(rest)
+		code := bytes.TrimSpace(next)
+		if len(next) != 0 && (next[0] == ' ' || next[0] == '\t') && len(code) != 0 && !bytes.HasPrefix(code, []byte(`File "`)) {
+			l.extra = code
+			rest = after
+		}
+
+	case bytes.HasPrefix(trimmed, []byte("Traceback (")), bytes.HasPrefix(trimmed, []byte("... ")), bytes.HasPrefix(trimmed, []byte("goroutine ")):
+		l.kind = traceText
+
+	// Go frame, the location is on the next line.
+	default:
+		next, after := cutLine(rest)
+		loc := bytes.TrimSpace(next)
+		if len(next) == 0 || next[0] != '\t' || !(bytes.Contains(loc, []byte(".go:")) || len(loc) != 0 && loc[0] == '/') {
+			break
+		}
+		l.kind = traceFrame
+		l.fn = trimmed
+		l.file = loc
+		if i := bytes.Index(loc, []byte(" +0x")); i != -1 {
+			l.file = loc[:i]
+			l.extra = loc[i+1:]
+		}
+		rest = after
+	}
+
+	return l, rest
+}
+
+func cutLine(text []byte) ([]byte, []byte) {
+	i := bytes.IndexByte(text, '\n')
+	if i == -1 {
+		return text, nil
+	}
+
+	return text[:i], text[i+1:]
+}
+
+// appendTrace appends the value of a stack trace or an error object as
+// lines separated with '\n'.
+func (f *formatter) appendTrace(buf *logf.Buffer, val []byte) {
+	switch {
+	case len(val) == 0:
+	case val[0] == '{':
+		f.appendErrorObject(buf, val)
+	case val[0] == '[':
+		f.appendTraceArray(buf, val)
+	default:
+		f.appendTraceText(buf, textValue(val), false)
+	}
+}
+
+// appendTraceText appends all lines of the text skipping empty ones.
+func (f *formatter) appendTraceText(buf *logf.Buffer, text []byte, bare bool) {
+	first := true
+	for len(text) != 0 {
+		var l traceLine
+		l, text = nextTraceLine(text, bare)
+		if l.kind == traceText && len(l.text) == 0 {
+			continue
+		}
+
+		if !first {
+			buf.AppendByte('\n')
+		}
+		first = false
+		f.appendTraceLine(buf, l)
+	}
+}
+
+func (f *formatter) appendTraceLine(buf *logf.Buffer, l traceLine) {
+	th := f.theme
+
+	switch l.kind {
+	case traceText:
+		th.StackFunction.at(buf, func() {
+			buf.AppendBytes(l.text)
+		})
+
+	case traceMessage:
+		th.Error.at(buf, func() {
+			buf.AppendBytes(l.text)
+		})
+
+	case traceFrame:
+		if len(l.fn) != 0 {
+			th.StackFunction.at(buf, func() {
+				buf.AppendBytes(l.fn)
+			})
+			buf.AppendByte(' ')
+		}
+		th.StackLocation.at(buf, func() {
+			buf.AppendBytes(l.file)
+			if len(l.line) != 0 {
+				buf.AppendByte(':')
+				buf.AppendBytes(l.line)
+			}
+		})
+		if len(l.extra) != 0 {
+			buf.AppendByte(' ')
+			th.StackFunction.at(buf, func() {
+				buf.AppendBytes(l.extra)
+			})
+		}
+	}
+}
+
+// appendTraceArray appends an array of error objects, where each next one
+// is the cause of the previous one, or an array of frames.
+func (f *formatter) appendTraceArray(buf *logf.Buffer, val []byte) {
+	first := true
+	walkArray(val, func(v []byte) bool {
+		if !first {
+			buf.AppendByte('\n')
+		}
+
+		if _, ok := parseErrorObject(v); ok {
+			if !first {
+				f.appendCausedBy(buf)
+			}
+			f.appendErrorObject(buf, v)
+		} else {
+			f.appendFrame(buf, v)
+		}
+		first = false
+
+		return true
+	})
+}
+
+func (f *formatter) appendCausedBy(buf *logf.Buffer) {
+	f.theme.Error.at(buf, func() {
+		buf.AppendString("Caused by: ")
+	})
+}
+
+// appendFrame appends a frame that is an element of an array: a string,
+// e.g. "at pkg.Class.method(Class.java:10)", or an object, e.g.
+// {"class":"pkg.Class","method":"method","file":"Class.java","line":10}.
+func (f *formatter) appendFrame(buf *logf.Buffer, val []byte) {
+	if len(val) == 0 || val[0] != '{' {
+		f.appendTraceText(buf, textValue(val), true)
+
+		return
+	}
+
+	var class, method []byte
+	l := traceLine{kind: traceFrame}
+	walkObject(val, func(k, v []byte) bool {
+		switch {
+		case matchKey(frameClassKeys, k):
+			class = textValue(v)
+		case matchKey(frameMethodKeys, k):
+			method = textValue(v)
+		case matchKey(frameFileKeys, k):
+			l.file = textValue(v)
+		case matchKey(frameLineKeys, k):
+			l.line = v
+		}
+
+		return true
+	})
+
+	switch {
+	case len(class) != 0 && len(method) != 0:
+		l.fn = make([]byte, 0, len(class)+len(method)+1)
+		l.fn = append(append(append(l.fn, class...), '.'), method...)
+	case len(class) != 0:
+		l.fn = class
+	default:
+		l.fn = method
+	}
+	if len(l.file) == 0 {
+		l.file = []byte("?")
+	}
+
+	f.appendTraceLine(buf, l)
+}
+
+// errorObject holds values of an object shaped like an error.
+type errorObject struct {
+	typ   []byte
+	msg   []byte
+	stack []byte
+	cause []byte
+}
+
+// parseErrorObject checks whether the value is an object with an error
+// message and a type or a stack trace.
+func parseErrorObject(val []byte) (errorObject, bool) {
+	var e errorObject
+	if len(val) == 0 || val[0] != '{' {
+		return e, false
+	}
+
+	ok := walkObject(val, func(k, v []byte) bool {
+		switch {
+		case matchKey(errorMessageKeys, k):
+			e.msg = v
+		case matchKey(errorTypeKeys, k):
+			e.typ = v
+		case matchKey(errorStackKeys, k):
+			e.stack = v
+		case matchKey(errorCauseKeys, k):
+			e.cause = v
+		}
+
+		return true
+	})
+
+	return e, ok && len(e.msg) != 0 && (len(e.typ) != 0 || len(e.stack) != 0)
+}
+
+// appendErrorObject appends "type: message" line followed by the stack
+// trace and the cause.
+func (f *formatter) appendErrorObject(buf *logf.Buffer, val []byte) {
+	e, _ := parseErrorObject(val)
+
+	f.theme.Error.at(buf, func() {
+		if len(e.typ) != 0 {
+			buf.AppendBytes(textValue(e.typ))
+			buf.AppendString(": ")
+		}
+		buf.AppendBytes(textValue(e.msg))
+	})
+
+	if len(e.stack) != 0 {
+		start := buf.Len()
+		buf.AppendByte('\n')
+		if e.stack[0] == '[' {
+			f.appendTraceArray(buf, e.stack)
+		} else {
+			f.appendTraceText(buf, textValue(e.stack), false)
+		}
+		if buf.Len() == start+1 {
+			buf.Data = buf.Data[:start]
+		}
+	}
+
+	if _, ok := parseErrorObject(e.cause); ok {
+		buf.AppendByte('\n')
+		f.appendCausedBy(buf)
+		f.appendErrorObject(buf, e.cause)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ssgreg/logf"
+)
+
+func TestAppendTrace(t *testing.T) {
+	cases := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{
+			"go",
+			`"main.handler\n\t/app/main.go:42\nruntime.main\n\t/usr/lib/go/src/runtime/proc.go:250 +0x1d"`,
+			"main.handler /app/main.go:42\nruntime.main /usr/lib/go/src/runtime/proc.go:250 +0x1d",
+		},
+		{
+			"java",
+			`"java.lang.IllegalStateException: boom\n\tat com.acme.Foo.bar(Foo.java:10)\n\t... 3 more\nCaused by: java.io.IOException: eof\n\tat java.io.Reader.read(Native Method)"`,
+			"java.lang.IllegalStateException: boom\ncom.acme.Foo.bar Foo.java:10\n... 3 more\nCaused by: java.io.IOException: eof\njava.io.Reader.read Native Method",
+		},
+		{
+			"python",
+			`"Traceback (most recent call last):\n  File \"/app/a.py\", line 3, in <module>\n    main()\nValueError: bad"`,
+			"Traceback (most recent call last):\n<module> /app/a.py:3 main()\nValueError: bad",
+		},
+		{
+			"object",
+			`{"type":"IOException","message":"eof","stack":[{"class":"java.io.Reader","method":"read","file":"Reader.java","line":7}],"cause":{"type":"X","message":"y"}}`,
+			"IOException: eof\njava.io.Reader.read Reader.java:7\nCaused by: X: y",
+		},
+		{
+			"array",
+			`[{"type":"A","message":"a","stack":["at p.C.m(C.java:1)"]},{"type":"B","message":"b"}]`,
+			"A: a\np.C.m C.java:1\nCaused by: B: b",
+		},
+	}
+
+	f := newFormatter(Options{NoColor: true})
+	for _, c := range cases {
+		field := Field{Key: []byte("stacktrace"), Value: []byte(c.value)}
+		if !isTrace(field) {
+			t.Errorf("%s: expected to be a trace", c.name)
+
+			continue
+		}
+
+		buf := logf.NewBuffer()
+		f.appendTrace(buf, field.Value)
+		if buf.String() != c.expected {
+			t.Errorf("%s: expected:\n%s\ngot:\n%s", c.name, c.expected, buf.String())
+		}
+	}
+
+	// Function lines followed by empty or whitespace-only lines are not
+	// frames.
+	for _, value := range []string{`"connection refused"`, `{"message":"x"}`, `42`, `"foo\n\t"`, `"foo\n\t  \nbar"`, `"foo\n\t\n"`} {
+		if isTrace(Field{Key: []byte("error"), Value: []byte(value)}) {
+			t.Errorf("%s: expected not to be a trace", value)
+		}
+	}
+}